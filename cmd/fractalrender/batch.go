@@ -0,0 +1,181 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"saph/graphic/palette"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// manifest lists the renders of a batch. Each job is an object of job
+// flag values by flag name, applied on top of the defaults:
+//
+//	{
+//		"defaults": {"size": "1920x1080", "o": "gallery/{{.name}}-{{.palette}}.png"},
+//		"jobs": [
+//			{"name": "seahorse", "center": "-0.7435,0.1314", "zoom": 200},
+//			{"name": "dendrite", "formula": "Julia", "c": "0,1", "palette": "Ocean"}
+//		]
+//	}
+//
+// Relative parameter files are found next to the manifest.
+type manifest struct {
+	Defaults map[string]json.RawMessage
+	Jobs     []map[string]json.RawMessage
+}
+
+// result is the outcome of a job of a batch.
+type result struct {
+	index    int
+	name     string
+	output   string
+	duration time.Duration
+	err      error
+}
+
+// runBatch runs the jobs of a manifest, at most -j at a time, and writes
+// a summary of them. It fails if any job failed.
+func runBatch(filename string, palettes *palette.Registry) error {
+	m, err := readManifest(filename)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	results := make([]result, len(m.Jobs))
+	jobs := make([]*job, len(m.Jobs))
+	outputs := make(map[string]int)
+	runnable := 0
+	for i, values := range m.Jobs {
+		results[i].index = i
+		json.Unmarshal(values["name"], &results[i].name)
+		jobs[i], results[i].err = newBatchJob(i, filepath.Dir(filename), m.Defaults, values, palettes)
+		if jobs[i] == nil {
+			continue
+		}
+		results[i].name, results[i].output = jobs[i].name, jobs[i].output
+		runnable++
+		if other, ok := outputs[jobs[i].output]; ok {
+			jobs[i], results[i].err = nil, fmt.Errorf("same output as job %d", other)
+			runnable--
+			continue
+		}
+		outputs[jobs[i].output] = i
+	}
+
+	limit := *jobLimit
+	if limit < 1 {
+		limit = 1
+	}
+	slots := make(chan bool, limit)
+	var mutex sync.Mutex
+	finished := 0
+	wg := new(sync.WaitGroup)
+	for i, j := range jobs {
+		if j == nil {
+			continue
+		}
+		wg.Add(1)
+		slots <- true
+		go func(r *result, j *job) {
+			defer wg.Done()
+			jobStart := time.Now()
+			if err := os.MkdirAll(filepath.Dir(j.output), 0755); err != nil {
+				r.err = err
+			} else {
+				r.err = j.run(func(float64) {})
+			}
+			r.duration = time.Since(jobStart)
+			<-slots
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			finished++
+			if !*quiet {
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s %v\n", finished, runnable, j.output, r.duration.Round(time.Millisecond))
+			}
+		}(&results[i], j)
+	}
+	wg.Wait()
+
+	w := io.Writer(os.Stdout)
+	if *report != "" {
+		file, err := os.Create(*report)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	failed := writeReport(w, results, time.Since(start))
+	if failed > 0 {
+		return fmt.Errorf("%d of %d renders failed", failed, len(results))
+	}
+	return nil
+}
+
+func readManifest(filename string) (*manifest, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	m := new(manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return m, nil
+}
+
+// newBatchJob builds job i of a manifest in dir from the defaults and its
+// own flag values.
+func newBatchJob(i int, dir string, defaults, values map[string]json.RawMessage, palettes *palette.Registry) (*job, error) {
+	fs := flag.NewFlagSet(fmt.Sprintf("job %d", i), flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	flags := newJobFlags(fs)
+	for _, v := range []map[string]json.RawMessage{defaults, values} {
+		for name, raw := range v {
+			// Strings are given unquoted, numbers and booleans as written.
+			value := string(raw)
+			json.Unmarshal(raw, &value)
+			if err := fs.Set(name, value); err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+		}
+	}
+	if p := *flags.paramsFile; p != "" && !filepath.IsAbs(p) {
+		*flags.paramsFile = filepath.Join(dir, p)
+	}
+	return flags.job(i, palettes)
+}
+
+// writeReport writes a line per job and the totals, and returns the number
+// of failed jobs.
+func writeReport(w io.Writer, results []result, wall time.Duration) int {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB\tNAME\tOUTPUT\tTIME\tSTATUS")
+	failed := 0
+	var total time.Duration
+	for _, r := range results {
+		status := "ok"
+		if r.err != nil {
+			status = "FAILED: " + r.err.Error()
+			failed++
+		}
+		total += r.duration
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%v\t%s\n", r.index, r.name, r.output, r.duration.Round(time.Millisecond), status)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d renders, %d failed, %v render time, %v wall time\n",
+		len(results), failed, total.Round(time.Millisecond), wall.Round(time.Millisecond))
+	return failed
+}
@@ -0,0 +1,126 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"saph/fractal"
+	"saph/graphic/palette"
+	"strings"
+	"testing"
+)
+
+func TestNewBatchJob(t *testing.T) {
+	defaults := map[string]json.RawMessage{
+		"size":       json.RawMessage(`"40x30"`),
+		"iterations": json.RawMessage(`50`),
+		"o":          json.RawMessage(`"out/{{.name}}-{{.palette}}-{{.index}}.png"`),
+	}
+	values := map[string]json.RawMessage{
+		"name":       json.RawMessage(`"seahorse"`),
+		"iterations": json.RawMessage(`80`),
+		"palette":    json.RawMessage(`"Ocean"`),
+		"shade":      json.RawMessage(`true`),
+	}
+	j, err := newBatchJob(3, "manifests", defaults, values, palette.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.output != "out/seahorse-Ocean-3.png" {
+		t.Errorf("output %q, want %q", j.output, "out/seahorse-Ocean-3.png")
+	}
+	if j.size.Width != 40 || j.size.Height != 30 {
+		t.Errorf("size %v, want 40x30", j.size)
+	}
+	if j.settings.MaxIterations != 80 {
+		t.Errorf("iterations %d, want the job's 80", j.settings.MaxIterations)
+	}
+	if len(slopeLayers(j.settings)) != 1 {
+		t.Error("shade: true gave no slope layer")
+	}
+
+	for _, values := range []map[string]json.RawMessage{
+		{"nosuchflag": json.RawMessage(`1`)},
+		{"iterations": json.RawMessage(`"many"`)},
+		{"palette": json.RawMessage(`"Nowhere"`)},
+		// Relative to the manifest directory, where it does not exist.
+		{"params": json.RawMessage(`"seahorse.json"`)},
+	} {
+		if _, err := newBatchJob(0, "manifests", defaults, values, palette.NewRegistry()); err == nil {
+			t.Errorf("%s accepted", values)
+		}
+	}
+}
+
+// A batch renders the jobs it can, reports every job and fails if any did.
+func TestRunBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fr := fractal.NewMandelbrot()
+	params, err := os.Create(filepath.Join(dir, "start.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := fractal.Settings{MaxIterations: 40, BailoutRadius: 4, SampleRatio: 1, ColorFrequency: 1,
+		Layers: []fractal.Layer{fractal.NewPaletteLayer(palette.Palette{palette.Red}, palette.Black)}}
+	if err := fr.SaveParams(params, s); err != nil {
+		t.Fatal(err)
+	}
+	params.Close()
+
+	m := map[string]interface{}{
+		"defaults": map[string]interface{}{"size": "16x12", "iterations": 40, "o": filepath.Join(dir, "out", "{{.name}}.png")},
+		"jobs": []map[string]interface{}{
+			{"name": "a"},
+			{"name": "b", "params": "start.json", "format": "png16"},
+			{"name": "a", "zoom": 2},
+			{"name": "c", "palette": "Nowhere"},
+		},
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, "batch.json")
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	oldQuiet, oldReport, oldLimit := *quiet, *report, *jobLimit
+	defer func() { *quiet, *report, *jobLimit = oldQuiet, oldReport, oldLimit }()
+	*quiet, *report, *jobLimit = true, filepath.Join(dir, "report.txt"), 2
+
+	err = runBatch(filename, palette.NewRegistry())
+	if err == nil || !strings.Contains(err.Error(), "2 of 4") {
+		t.Errorf("runBatch: %v, want 2 of 4 failed", err)
+	}
+	for _, name := range []string{"a.png", "b.png"} {
+		file, err := os.Open(filepath.Join(dir, "out", name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if _, _, _, err := fractal.DecodePNG(file); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		file.Close()
+	}
+	text, err := ioutil.ReadFile(*report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(text), "\n")
+	for i, want := range []string{"ok", "ok", "FAILED: same output as job 0", "FAILED: unknown palette"} {
+		if i+1 >= len(lines) || !strings.Contains(lines[i+1], want) {
+			t.Errorf("report line for job %d does not say %q:\n%s", i, want, text)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"saph/fractal"
+	"saph/graphic"
+	"saph/graphic/palette"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// jobFlags are the flags describing a single render. They are given on
+// the command line, or by the entries of a batch manifest.
+type jobFlags struct {
+	*flag.FlagSet
+	name          *string
+	paramsFile    *string
+	formula       *string
+	juliaConstant *string
+	center        *string
+	zoom          *float64
+	bounds        *string
+	rotation      *float64
+	size          *string
+	iterations    *int
+	bailout       *float64
+	samples       *int
+	normalize     *bool
+	frequency     *float64
+	offset        *float64
+	paletteName   *string
+	setColorName  *string
+	shade         *bool
+	lightAngle    *float64
+	heightScale   *float64
+	ambient       *float64
+	format        *string
+	output        *string
+	checkpoint    *string
+}
+
+func newJobFlags(fs *flag.FlagSet) *jobFlags {
+	return &jobFlags{
+		FlagSet:       fs,
+		name:          fs.String("name", "fractal", "name of the render, for output templates"),
+		paramsFile:    fs.String("params", "", "parameter file to start from"),
+		formula:       fs.String("formula", "Mandelbrot", "Mandelbrot or Julia"),
+		juliaConstant: fs.String("c", "-0.8,0.156", "Julia constant re,im"),
+		center:        fs.String("center", "", "center of the view re,im"),
+		zoom:          fs.Float64("zoom", 1, "magnification of the view around -center"),
+		bounds:        fs.String("bounds", "", "view as xmin,ymin,xmax,ymax, with the height fitted to -size"),
+		rotation:      fs.Float64("rotation", 0, "counterclockwise turn of the view, in radians"),
+		size:          fs.String("size", "1920x1200", "image size WxH"),
+		iterations:    fs.Int("iterations", 300, "maximum iterations"),
+		bailout:       fs.Float64("bailout", 20, "bailout radius"),
+		samples:       fs.Int("samples", 1, "samples per pixel along each axis"),
+		normalize:     fs.Bool("normalize", true, "smooth the iteration count"),
+		frequency:     fs.Float64("frequency", 20, "color frequency"),
+		offset:        fs.Float64("offset", 0, "palette rotation, in whole turns"),
+		paletteName:   fs.String("palette", "Peach", "palette name"),
+		setColorName:  fs.String("setcolor", "Black", "color of the set"),
+		shade:         fs.Bool("shade", false, "light the image as a heightfield of the iteration count"),
+		lightAngle:    fs.Float64("lightangle", fractal.DefaultLighting.Azimuth, "direction of the shading light, counterclockwise in radians"),
+		heightScale:   fs.Float64("heightscale", fractal.DefaultLighting.HeightScale, "steepness of the shading heightfield"),
+		ambient:       fs.Float64("ambient", fractal.DefaultLighting.Ambient, "shading light reaching every pixel, 0 to 1"),
+		format:        fs.String("format", "", "png, png16 or pfm (default from the output name)"),
+		output:        fs.String("o", "{{.name}}.png", "output file, a template of the flag values and {{.index}}"),
+		checkpoint:    fs.String("checkpoint", "", "directory to keep PNG progress in, for resuming"),
+	}
+}
+
+// job is a single render and the file it is written to.
+type job struct {
+	name       string
+	fractal    *fractal.Fractal
+	settings   fractal.Settings
+	size       graphic.Box
+	format     string
+	output     string
+	checkpoint string
+}
+
+// job builds the job described by the flags. The output name is
+// expanded as a template of the flag values, see outputName.
+func (f *jobFlags) job(index int, palettes *palette.Registry) (*job, error) {
+	set := make(map[string]bool)
+	f.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	j := &job{name: *f.name, format: *f.format, checkpoint: *f.checkpoint}
+	var err error
+	if j.output, err = f.outputName(index); err != nil {
+		return nil, err
+	}
+	if j.size, err = parseSize(*f.size); err != nil {
+		return nil, err
+	}
+	if j.format == "" {
+		j.format = "png"
+		if strings.EqualFold(filepath.Ext(j.output), ".pfm") {
+			j.format = "pfm"
+		}
+	}
+	if j.format != "png" && j.format != "png16" && j.format != "pfm" {
+		return nil, fmt.Errorf("unknown format %q", j.format)
+	}
+	if j.checkpoint != "" && j.format == "pfm" {
+		return nil, fmt.Errorf("-checkpoint only works with PNG output")
+	}
+
+	if *f.paramsFile != "" {
+		file, err := os.Open(*f.paramsFile)
+		if err != nil {
+			return nil, err
+		}
+		j.fractal, j.settings, err = fractal.LoadParams(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", *f.paramsFile, err)
+		}
+	} else {
+		set["palette"], set["setcolor"] = true, true
+		j.settings = fractal.Settings{
+			MaxIterations:  *f.iterations,
+			BailoutRadius:  *f.bailout,
+			Normalize:      *f.normalize,
+			SampleRatio:    *f.samples,
+			ColorFrequency: *f.frequency,
+			ColorOffset:    *f.offset,
+			Layers:         []fractal.Layer{fractal.NewPaletteLayer(nil, palette.Black)},
+		}
+	}
+
+	// A parameter file gives the formula and Julia constant unless the
+	// flags are set.
+	if j.fractal == nil || set["formula"] || set["c"] {
+		name := *f.formula
+		if j.fractal != nil && !set["formula"] {
+			name = "Mandelbrot"
+			if !j.fractal.IsMandelbrot() {
+				name = "Julia"
+			}
+		}
+		c, err := parseFloats(*f.juliaConstant, 2)
+		if err != nil {
+			return nil, fmt.Errorf("-c: %v", err)
+		}
+		juliaC := complex(c[0], c[1])
+		if j.fractal != nil && !set["c"] {
+			juliaC = j.fractal.JuliaConstant()
+		}
+		fr, err := fractal.NewFormula(name, juliaC)
+		if err != nil {
+			return nil, err
+		}
+		if j.fractal != nil && !set["formula"] {
+			fr.SetViewport(j.fractal.Viewport())
+		}
+		j.fractal = fr
+	}
+
+	switch {
+	case set["bounds"]:
+		b, err := parseFloats(*f.bounds, 4)
+		if err != nil {
+			return nil, fmt.Errorf("-bounds: %v", err)
+		}
+		j.fractal.SetBounds(fractal.Bounds{XMin: b[0], YMin: b[1], XMax: b[2], YMax: b[3]})
+	case set["center"] || set["zoom"]:
+		c := []float64{0, 0}
+		if *f.center != "" {
+			if c, err = parseFloats(*f.center, 2); err != nil {
+				return nil, fmt.Errorf("-center: %v", err)
+			}
+		}
+		if *f.zoom <= 0 {
+			return nil, fmt.Errorf("-zoom must be positive")
+		}
+		aspect := float64(j.size.Height) / float64(j.size.Width)
+		j.fractal.SetView(complex(c[0], c[1]), *f.zoom, aspect)
+	}
+	// Views from the defaults, bounds or parameter files are fitted to
+	// the output size, so that its pixels are square.
+	v := j.fractal.Viewport().Fit(j.size)
+	if set["rotation"] {
+		v.Rotation = *f.rotation
+	}
+	j.fractal.SetViewport(v)
+
+	s := &j.settings
+	if set["iterations"] {
+		s.MaxIterations = *f.iterations
+	}
+	if set["bailout"] {
+		s.BailoutRadius = *f.bailout
+	}
+	if set["samples"] {
+		s.SampleRatio = *f.samples
+	}
+	if set["normalize"] {
+		s.Normalize = *f.normalize
+	}
+	if set["frequency"] {
+		s.ColorFrequency = *f.frequency
+	}
+	if set["offset"] {
+		s.ColorOffset = *f.offset
+	}
+	if s.MaxIterations < 1 {
+		return nil, fmt.Errorf("-iterations must be positive")
+	}
+	if s.BailoutRadius <= 1 {
+		return nil, fmt.Errorf("-bailout must be greater than 1")
+	}
+	// Parameter files of the explorer may have ratios below 1, which
+	// render like 1.
+	if s.SampleRatio < -3 {
+		return nil, fmt.Errorf("-samples must be at least -3")
+	}
+	if set["palette"] || set["setcolor"] {
+		if err := f.setPalette(s, palettes, set["palette"], set["setcolor"]); err != nil {
+			return nil, err
+		}
+	}
+	if set["shade"] || set["lightangle"] || set["heightscale"] || set["ambient"] {
+		if err := f.setShading(s, set); err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// outputName expands the output template. Its data are the flag values
+// by flag name and the index of the job.
+func (f *jobFlags) outputName(index int) (string, error) {
+	tmpl, err := template.New("o").Option("missingkey=error").Parse(*f.output)
+	if err != nil {
+		return "", fmt.Errorf("-o: %v", err)
+	}
+	data := map[string]interface{}{"index": index}
+	f.VisitAll(func(fl *flag.Flag) { data[fl.Name] = fl.Value.String() })
+	var name bytes.Buffer
+	if err := tmpl.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("-o: %v", err)
+	}
+	return name.String(), nil
+}
+
+// setPalette sets the palette and set color of the palette layers of s
+// to those named by the -palette and -setcolor flags.
+func (f *jobFlags) setPalette(s *fractal.Settings, palettes *palette.Registry, setPalette, setColor bool) error {
+	p, ok := palettes.Palette(*f.paletteName)
+	if !ok {
+		return fmt.Errorf("unknown palette %q, have %s", *f.paletteName, strings.Join(palettes.PaletteNames(), ", "))
+	}
+	c, ok := palettes.Color(*f.setColorName)
+	if !ok {
+		return fmt.Errorf("unknown color %q, have %s", *f.setColorName, strings.Join(palettes.ColorNames(), ", "))
+	}
+	s.Layers = append([]fractal.Layer(nil), s.Layers...)
+	for i := range s.Layers {
+		if l := &s.Layers[i]; l.Kind == fractal.PaletteLayer {
+			if setPalette {
+				l.Palette = p
+			}
+			if setColor {
+				l.SetColor = c
+			}
+		}
+	}
+	return nil
+}
+
+// run renders the job into its output file.
+func (j *job) run(progress func(done float64)) error {
+	file, err := os.Create(j.output)
+	if err != nil {
+		return err
+	}
+	switch j.format {
+	case "pfm":
+		var pixChan chan graphic.Pixel
+		if pixChan, err = j.fractal.Render(j.size, j.settings); err != nil {
+			break
+		}
+		pixels, count := j.size.Width*j.size.Height, 0
+		for range pixChan {
+			if count++; count%j.size.Width == 0 {
+				progress(float64(count) / float64(pixels))
+			}
+		}
+		err = graphic.WritePFM(file, j.fractal.Buffer().FloatImage(j.settings))
+	default:
+		poster := fractal.Poster{
+			Box:        j.size,
+			Deep:       j.format == "png16",
+			Progress:   progress,
+			Checkpoint: j.checkpoint,
+		}
+		err = j.fractal.EncodePoster(file, poster, j.settings)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// setShading adds or removes the slope layer of s by the -shade flag, and
+// sets the light of its slope layers from the light flags. The light flags
+// turn shading on unless -shade is false.
+func (f *jobFlags) setShading(s *fractal.Settings, set map[string]bool) error {
+	if *f.heightScale < 0 {
+		return fmt.Errorf("-heightscale must not be negative")
+	}
+	if *f.ambient < 0 || *f.ambient > 1 {
+		return fmt.Errorf("-ambient must be between 0 and 1")
+	}
+	light := func(l fractal.Lighting) fractal.Lighting {
+		if set["lightangle"] {
+			l.Azimuth = *f.lightAngle
+		}
+		if set["heightscale"] {
+			l.HeightScale = *f.heightScale
+		}
+		if set["ambient"] {
+			l.Ambient = *f.ambient
+		}
+		return l
+	}
+	shade := !set["shade"] || *f.shade
+	var layers []fractal.Layer
+	shaded := false
+	for _, l := range s.Layers {
+		if l.Kind == fractal.SlopeLayer {
+			if !shade {
+				continue
+			}
+			l.Lighting = light(l.Lighting)
+			shaded = true
+		}
+		layers = append(layers, l)
+	}
+	if shade && !shaded {
+		layers = append(layers, fractal.NewSlopeLayer(light(fractal.DefaultLighting)))
+	}
+	s.Layers = layers
+	return nil
+}
+
+func parseSize(s string) (graphic.Box, error) {
+	var b graphic.Box
+	if _, err := fmt.Sscanf(s, "%dx%d", &b.Width, &b.Height); err != nil || b.Width < 1 || b.Height < 1 {
+		return b, fmt.Errorf("invalid size %q, want WxH", s)
+	}
+	return b, nil
+}
+
+// parseFloats parses n comma separated numbers.
+func parseFloats(s string, n int) ([]float64, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != n {
+		return nil, fmt.Errorf("want %d comma separated numbers, got %q", n, s)
+	}
+	values := make([]float64, n)
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
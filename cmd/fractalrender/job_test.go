@@ -0,0 +1,95 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"flag"
+	"math"
+	"saph/fractal"
+	"saph/graphic/palette"
+	"testing"
+)
+
+// testJob builds the job of the command line args.
+func testJob(t *testing.T, args ...string) (*job, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := newJobFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return f.job(0, palette.NewRegistry())
+}
+
+// slopeLayers returns the slope layers of s.
+func slopeLayers(s fractal.Settings) []fractal.Layer {
+	var layers []fractal.Layer
+	for _, l := range s.Layers {
+		if l.Kind == fractal.SlopeLayer {
+			layers = append(layers, l)
+		}
+	}
+	return layers
+}
+
+func TestShadingFlags(t *testing.T) {
+	j, err := testJob(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(slopeLayers(j.settings)); n != 0 {
+		t.Errorf("%d slope layers without -shade", n)
+	}
+
+	j, err = testJob(t, "-shade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := slopeLayers(j.settings); len(l) != 1 || l[0].Lighting != fractal.DefaultLighting {
+		t.Errorf("-shade: slope layers %+v, want one with the default light", l)
+	}
+
+	j, err = testJob(t, "-lightangle", "0.5", "-heightscale", "3", "-ambient", "0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fractal.DefaultLighting
+	want.Azimuth, want.HeightScale, want.Ambient = 0.5, 3, 0.1
+	if l := slopeLayers(j.settings); len(l) != 1 || l[0].Lighting != want {
+		t.Errorf("light flags: slope layers %+v, want one lit by %+v", l, want)
+	}
+
+	j, err = testJob(t, "-shade=false", "-ambient", "0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(slopeLayers(j.settings)); n != 0 {
+		t.Errorf("%d slope layers with -shade=false", n)
+	}
+
+	for _, args := range [][]string{{"-ambient", "1.5"}, {"-ambient", "-0.1"}, {"-heightscale", "-1"}} {
+		if _, err := testJob(t, args...); err == nil {
+			t.Errorf("%v accepted", args)
+		}
+	}
+}
+
+// Every view is fitted to the output size, so that pixels are square.
+func TestJobFitsView(t *testing.T) {
+	for _, args := range [][]string{
+		{"-size", "100x100"},
+		{"-size", "300x100"},
+		{"-size", "100x100", "-bounds", "-2,-1,1,1"},
+		{"-size", "100x300", "-bounds", "-2,-1,1,1", "-rotation", "0.5"},
+		{"-size", "200x100", "-center", "-0.5,0", "-zoom", "4"},
+	} {
+		j, err := testJob(t, args...)
+		if err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		v := j.fractal.Viewport()
+		if got, want := v.Height/v.Width, float64(j.size.Height)/float64(j.size.Width); math.Abs(got-want) > 1e-12 {
+			t.Errorf("%v: view %gx%g, want the shape of %v", args, v.Width, v.Height, j.size)
+		}
+	}
+}
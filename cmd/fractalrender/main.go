@@ -0,0 +1,184 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+// Command fractalrender renders fractals to image files without a
+// display.
+//
+//	fractalrender -center -0.7435,0.1314 -zoom 2000 -size 3840x2160 -o seahorse.png
+//	fractalrender -params saved.json -format png16 -o poster.png
+//	fractalrender -shade -lightangle 0.8 -ambient 0.2 -o embossed.png
+//	fractalrender -batch gallery.json -j 4
+//	fractalrender -params start.json -size 1280x720 -animation zoom.json -frames zoom
+//	fractalrender -size 480x270 -animation zoom.json -frames zoom.gif -fps 30
+//	fractalrender -formula julia -size 640x400 -morph cardioid.json -frames morph.gif
+//
+// Flags given on the command line override those of the parameter file.
+// A batch manifest lists many renders, see runBatch. An animation is
+// rendered from the keyframes of animation.ReadKeyframes, starting from
+// the fractal and settings given by the other flags. A morph of
+// animation.ReadMorph renders Julia sets along a path of constants, viewed
+// as the Julia view of the other flags.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"saph/fractal/animation"
+	"saph/graphic"
+	"saph/graphic/palette"
+	"strings"
+	"time"
+)
+
+var (
+	batch      = flag.String("batch", "", "manifest of renders to run")
+	jobLimit   = flag.Int("j", runtime.NumCPU(), "renders of a batch to run at the same time")
+	report     = flag.String("report", "", "file for the batch summary instead of standard output")
+	paletteDir = flag.String("palettes", "", "directory of extra palette files")
+	keyframes  = flag.String("animation", "", "keyframes of an animation to render, as JSON with Frame, Center, Zoom and optionally Rotation")
+	morph      = flag.String("morph", "", "path of Julia constants of an animation to render")
+	frameDir   = flag.String("frames", "frames", "animation output: a .gif, a .png (APNG) or a directory for numbered frames")
+	fps        = flag.Float64("fps", 25, "frames per second of an animated GIF (at most 100) or PNG")
+	loops      = flag.Int("loops", 0, "plays of an animated GIF or PNG, 0 for forever")
+	gifFrames  = flag.Bool("gifframes", false, "give each GIF frame its own palette instead of one from the fractal palette")
+	accelerate = flag.Bool("accelerate", false, "resample animation frames from renders at zoom doublings, if the keyframes share Julia constant and iterations")
+	quiet      = flag.Bool("q", false, "do not report progress")
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("fractalrender: ")
+	flags := newJobFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: fractalrender [flags]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	palettes := palette.NewRegistry()
+	if *paletteDir != "" {
+		if err := palettes.LoadDir(*paletteDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *batch != "" {
+		if err := runBatch(*batch, palettes); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	j, err := flags.job(0, palettes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	name := j.output
+	if *keyframes != "" || *morph != "" {
+		name = *frameDir
+	}
+	progress := func(done float64) {
+		if !*quiet {
+			fmt.Fprintf(os.Stderr, "\r%s %3.0f%%", name, done*100)
+		}
+	}
+	switch {
+	case *keyframes != "" && *morph != "":
+		err = fmt.Errorf("-animation and -morph are exclusive")
+	case *keyframes != "":
+		err = animate(j, *keyframes, *frameDir, progress)
+	case *morph != "":
+		err = animateMorph(j, *morph, *frameDir, progress)
+	default:
+		err = j.run(progress)
+	}
+	if !*quiet {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// animate renders the animation of the keyframes in filename into the
+// animation or directory named output, with the fractal type, size and
+// settings of j.
+func animate(j *job, filename, output string, progress func(float64)) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	keyframes, err := animation.ReadKeyframes(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	a := &animation.Animation{
+		Julia:      !j.fractal.IsMandelbrot(),
+		Size:       j.size,
+		Settings:   j.settings,
+		Keyframes:  keyframes,
+		Accelerate: *accelerate,
+	}
+	return writeAnimation(a, j, output, progress)
+}
+
+// animateMorph renders the Julia morph in filename like animate. The view
+// is that of j if it is a Julia set, or else the default Julia view.
+func animateMorph(j *job, filename, output string, progress func(float64)) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	m, err := animation.ReadMorph(file)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	center, zoom, rotation := complex128(0), 1.0, 0.0
+	if !j.fractal.IsMandelbrot() {
+		center, zoom = j.fractal.View()
+		rotation = j.fractal.Viewport().Rotation
+	}
+	keyframes, err := m.Keyframes(center, zoom)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	for i := range keyframes {
+		keyframes[i].Rotation = rotation
+	}
+	a := &animation.Animation{
+		Julia:     true,
+		Size:      j.size,
+		Settings:  j.settings,
+		Keyframes: keyframes,
+	}
+	return writeAnimation(a, j, output, progress)
+}
+
+func writeAnimation(a *animation.Animation, j *job, output string, progress func(float64)) error {
+	if *fps <= 0 {
+		return fmt.Errorf("-fps must be positive")
+	}
+	if *fps > 100 && strings.EqualFold(filepath.Ext(output), ".gif") {
+		return fmt.Errorf("-fps can be at most 100 for a GIF")
+	}
+	var p color.Palette
+	if !*gifFrames {
+		p = j.settings.QuantizationPalette(256)
+	}
+	delay := time.Duration(float64(time.Second) / *fps)
+	w, err := graphic.CreateFrameWriter(output, a.Frames(), delay, *loops, p)
+	if err != nil {
+		return err
+	}
+	return a.Write(w, progress)
+}
@@ -0,0 +1,184 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package animation
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"saph/fractal"
+	"saph/graphic"
+	"sync"
+)
+
+const (
+	levelMargin = 1.25 // extent of a level relative to the view at its zoom, if the center moves
+	levelDetail = 2    // resolution of a level relative to a frame at its zoom
+	levelFade   = 0.1  // fraction of a level over which it fades out at its edges
+)
+
+// level is a render at a zoom of a power of two. The frames up to twice
+// that zoom are resampled from it and the level above it, instead of being
+// rendered.
+type level struct {
+	view   fractal.Viewport
+	buffer *fractal.Buffer
+	offset float64 // color offset of img
+	img    *image.RGBA
+}
+
+// accelerator synthesizes the frames of an animation from levels.
+type accelerator struct {
+	*Animation
+	levels map[int]*level
+	margin float64 // extent of a level relative to the view at its zoom
+}
+
+func newAccelerator(a *Animation) *accelerator {
+	acc := &accelerator{a, make(map[int]*level), 1}
+	for _, k := range a.Keyframes {
+		if k.Center != a.Keyframes[0].Center || k.Rotation != a.Keyframes[0].Rotation {
+			acc.margin = levelMargin
+		}
+	}
+	return acc
+}
+
+// level returns level k, rendering it around the view of key if needed.
+func (acc *accelerator) level(k int, key Keyframe) (*level, error) {
+	if l, ok := acc.levels[k]; ok {
+		return l, nil
+	}
+	key.Zoom = math.Pow(2, float64(k)) / acc.margin
+	fr, s := acc.Fractal(key)
+	size := graphic.Box{
+		Width:  int(float64(acc.Size.Width)*levelDetail*acc.margin + 0.5),
+		Height: int(float64(acc.Size.Height)*levelDetail*acc.margin + 0.5),
+	}
+	img, err := render(fr, size, s)
+	if err != nil {
+		return nil, err
+	}
+	l := &level{view: fr.Viewport(), buffer: fr.Buffer(), offset: s.ColorOffset, img: img}
+	acc.levels[k] = l
+	return l, nil
+}
+
+// image returns the level colored with s.
+func (l *level) image(s fractal.Settings) *image.RGBA {
+	if s.ColorOffset != l.offset {
+		l.offset, l.img = s.ColorOffset, l.buffer.Image(s)
+	}
+	return l.img
+}
+
+// pos returns the position of the point p in pixels of the level.
+func (l *level) pos(p complex128) (x, y float64) {
+	return l.view.Pixel(l.buffer.Box, p)
+}
+
+// covers reports whether the level contains the view v of a frame of
+// size, give or take half a pixel.
+func (l *level) covers(v fractal.Viewport, size graphic.Box) bool {
+	w, h := float64(size.Width), float64(size.Height)
+	for _, corner := range [4][2]float64{{0, 0}, {w, 0}, {0, h}, {w, h}} {
+		x, y := l.pos(v.Point(size, corner[0], corner[1]))
+		if x < -0.5 || y < -0.5 || x > float64(l.buffer.Width)+0.5 || y > float64(l.buffer.Height)+0.5 {
+			return false
+		}
+	}
+	return true
+}
+
+// weight is 1 inside the level and fades to 0 towards its edges.
+func (l *level) weight(x, y float64) float64 {
+	w, h := float64(l.buffer.Width-1), float64(l.buffer.Height-1)
+	d := math.Min(math.Min(x, w-x)/w, math.Min(y, h-y)/h) / levelFade
+	return math.Max(0, math.Min(1, d))
+}
+
+// frame synthesizes a frame from the levels at and above its zoom. Frames
+// that leave the levels, such as during fast pans, are rendered.
+func (acc *accelerator) frame(frame int) (*image.RGBA, error) {
+	key := acc.At(frame)
+	fr, s := acc.Fractal(key)
+	k := int(math.Floor(math.Log2(key.Zoom)))
+	lo, err := acc.level(k, key)
+	if err != nil {
+		return nil, err
+	}
+	hi, err := acc.level(k+1, key)
+	if err != nil {
+		return nil, err
+	}
+	for j := range acc.levels {
+		if j != k && j != k+1 {
+			delete(acc.levels, j)
+		}
+	}
+	v := fr.Viewport()
+	if !lo.covers(v, acc.Size) {
+		delete(acc.levels, k)
+		delete(acc.levels, k+1)
+		return render(fr, acc.Size, s)
+	}
+
+	// Blend towards the level above as the zoom approaches it.
+	u := math.Log2(key.Zoom) - float64(k)
+	loImg, hiImg := lo.image(s), hi.image(s)
+	img := image.NewRGBA(image.Rect(0, 0, acc.Size.Width, acc.Size.Height))
+	wg := new(sync.WaitGroup)
+	for row := 0; row < acc.Size.Height; row++ {
+		wg.Add(1)
+		go func(row int) {
+			for col := 0; col < acc.Size.Width; col++ {
+				// Average a 2x2 grid over the pixel, since the levels
+				// are finer than the frame.
+				var sum [3]float64
+				for _, d := range [4][2]float64{{-0.25, -0.25}, {0.25, -0.25}, {-0.25, 0.25}, {0.25, 0.25}} {
+					p := v.Point(acc.Size, float64(col)+d[0], float64(row)+d[1])
+					x, y := lo.pos(p)
+					c := bilinear(loImg, x, y)
+					x, y = hi.pos(p)
+					if w := u * hi.weight(x, y); w > 0 {
+						c2 := bilinear(hiImg, x, y)
+						for i := range c {
+							c[i] += (c2[i] - c[i]) * w
+						}
+					}
+					for i := range sum {
+						sum[i] += c[i] / 4
+					}
+				}
+				img.SetRGBA(col, row, color.RGBA{uint8(sum[0] + 0.5), uint8(sum[1] + 0.5), uint8(sum[2] + 0.5), 0xFF})
+			}
+			wg.Done()
+		}(row)
+	}
+	wg.Wait()
+	return img, nil
+}
+
+// bilinear interpolates img at the position x, y, clamped to its edges.
+func bilinear(img *image.RGBA, x, y float64) [3]float64 {
+	r := img.Rect
+	x = math.Max(0, math.Min(float64(r.Dx()-1), x))
+	y = math.Max(0, math.Min(float64(r.Dy()-1), y))
+	x0, y0 := int(x), int(y)
+	x1, y1 := x0+1, y0+1
+	if x1 >= r.Dx() {
+		x1 = x0
+	}
+	if y1 >= r.Dy() {
+		y1 = y0
+	}
+	fx, fy := x-float64(x0), y-float64(y0)
+	var c [3]float64
+	for i := 0; i < 3; i++ {
+		a := float64(img.Pix[img.PixOffset(x0, y0)+i])*(1-fx) + float64(img.Pix[img.PixOffset(x1, y0)+i])*fx
+		b := float64(img.Pix[img.PixOffset(x0, y1)+i])*(1-fx) + float64(img.Pix[img.PixOffset(x1, y1)+i])*fx
+		c[i] = a*(1-fy) + b*fy
+	}
+	return c
+}
@@ -0,0 +1,106 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package animation
+
+import (
+	"image"
+	"math"
+	"saph/fractal"
+	"saph/graphic"
+	"saph/graphic/palette"
+	"testing"
+)
+
+// accelerateTolerance is the mean channel difference allowed between
+// resampled and rendered frames.
+const accelerateTolerance = 20
+
+func testAnimation(keyframes ...Keyframe) *Animation {
+	return &Animation{
+		Size: graphic.Box{Width: 64, Height: 48},
+		Settings: fractal.Settings{
+			MaxIterations:  64,
+			BailoutRadius:  16,
+			Normalize:      true,
+			SampleRatio:    1,
+			ColorFrequency: 1,
+			Layers:         []fractal.Layer{fractal.NewPaletteLayer(palette.Palette{palette.Black, palette.White}, palette.Black)},
+		},
+		Keyframes:  keyframes,
+		Accelerate: true,
+	}
+}
+
+// meanDiff is the mean difference of the channels of a and b.
+func meanDiff(a, b *image.RGBA) float64 {
+	var sum float64
+	for i := range a.Pix {
+		sum += math.Abs(float64(a.Pix[i]) - float64(b.Pix[i]))
+	}
+	return sum / float64(len(a.Pix))
+}
+
+// Resampled frames look like rendered ones, from the first to the last
+// frame and for zooms below 1.
+func TestAcceleratedFrames(t *testing.T) {
+	for _, c := range []struct {
+		name      string
+		keyframes []Keyframe
+	}{
+		{"zoom in", []Keyframe{
+			{Frame: 0, Center: complex(-0.75, 0.1), Zoom: 1},
+			{Frame: 6, Center: complex(-0.75, 0.1), Zoom: 10},
+		}},
+		{"zoom out below 1", []Keyframe{
+			{Frame: 0, Center: complex(-0.5, 0), Zoom: 0.9},
+			{Frame: 4, Center: complex(-0.5, 0), Zoom: 0.3},
+		}},
+		{"moving center", []Keyframe{
+			{Frame: 0, Center: complex(-0.5, 0), Zoom: 1.5},
+			{Frame: 4, Center: complex(-0.6, 0.1), Zoom: 3},
+		}},
+	} {
+		a := testAnimation(c.keyframes...)
+		acc := newAccelerator(a)
+		for i := 0; i < a.Frames(); i++ {
+			got, err := acc.frame(i)
+			if err != nil {
+				t.Fatalf("%s: frame %d: %v", c.name, i, err)
+			}
+			want, err := a.Render(i)
+			if err != nil {
+				t.Fatalf("%s: frame %d: %v", c.name, i, err)
+			}
+			if got.Rect != want.Rect {
+				t.Fatalf("%s: frame %d is %v, want %v", c.name, i, got.Rect, want.Rect)
+			}
+			if d := meanDiff(got, want); d > accelerateTolerance {
+				t.Errorf("%s: frame %d differs by %.1f on average from a render", c.name, i, d)
+			}
+		}
+	}
+}
+
+// Frames that leave the levels are rendered.
+func TestAcceleratedJump(t *testing.T) {
+	a := testAnimation(
+		Keyframe{Frame: 0, Center: complex(-0.5, 0), Zoom: 4},
+		Keyframe{Frame: 1, Center: complex(0.3, 0.5), Zoom: 4},
+	)
+	acc := newAccelerator(a)
+	if _, err := acc.frame(0); err != nil {
+		t.Fatal(err)
+	}
+	got, err := acc.frame(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := a.Render(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := meanDiff(got, want); d != 0 {
+		t.Errorf("frame outside the levels differs by %.1f on average from a render", d)
+	}
+}
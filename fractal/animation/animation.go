@@ -0,0 +1,189 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+// Package animation renders zoom animations of fractals from keyframes.
+package animation
+
+import (
+	"errors"
+	"image"
+	"math"
+	"saph/fractal"
+	"saph/graphic"
+	"saph/graphic/palette"
+)
+
+// Keyframe is the view and coloring at a frame of an animation.
+type Keyframe struct {
+	Frame         int
+	Center        complex128
+	Zoom          float64    // magnification, see Fractal.SetView
+	Rotation      float64    // counterclockwise, in radians
+	JuliaConstant complex128 // used by Julia animations
+	ColorOffset   float64
+	MaxIterations int            // 0 keeps the iterations of the settings
+	Easing        palette.Easing // shapes the transition to the next keyframe
+}
+
+// Animation interpolates between keyframes, ordered by frame. The zoom is
+// interpolated exponentially, so that zooming appears to run at a
+// constant speed, and the center follows so that the target stays in
+// view. The rotation turns at a constant speed.
+//
+// With Accelerate, only the views at zooms of powers of two are rendered,
+// at a higher resolution, and the frames between them are resampled and
+// blended from those. Since a level is shared by all frames near its zoom,
+// this is only done when the keyframes agree on the Julia constant and the
+// iterations; otherwise every frame is rendered.
+type Animation struct {
+	Julia      bool // Julia sets of the keyframe constants instead of the Mandelbrot set
+	Size       graphic.Box
+	Settings   fractal.Settings
+	Keyframes  []Keyframe
+	Accelerate bool
+}
+
+// Frames is the number of frames of the animation.
+func (a *Animation) Frames() int {
+	if len(a.Keyframes) == 0 {
+		return 0
+	}
+	return a.Keyframes[len(a.Keyframes)-1].Frame + 1
+}
+
+func (a *Animation) check() error {
+	if len(a.Keyframes) == 0 {
+		return errors.New("animation: no keyframes")
+	}
+	for i, k := range a.Keyframes {
+		if k.Zoom <= 0 {
+			return errors.New("animation: zoom must be positive")
+		}
+		if i > 0 && k.Frame <= a.Keyframes[i-1].Frame {
+			return errors.New("animation: keyframes out of order")
+		}
+	}
+	return nil
+}
+
+// sameFractal reports whether the keyframes only differ in view and
+// coloring, so that frames can be resampled from each other.
+func (a *Animation) sameFractal() bool {
+	k0 := a.Keyframes[0]
+	for _, k := range a.Keyframes[1:] {
+		if k.MaxIterations != k0.MaxIterations || a.Julia && k.JuliaConstant != k0.JuliaConstant {
+			return false
+		}
+	}
+	return true
+}
+
+// At interpolates the keyframes at frame.
+func (a *Animation) At(frame int) Keyframe {
+	ks := a.Keyframes
+	if frame <= ks[0].Frame {
+		return ks[0]
+	}
+	for i := 1; i < len(ks); i++ {
+		if frame < ks[i].Frame {
+			return interpolate(ks[i-1], ks[i], frame)
+		}
+	}
+	return ks[len(ks)-1]
+}
+
+func interpolate(k0, k1 Keyframe, frame int) Keyframe {
+	t := float64(frame-k0.Frame) / float64(k1.Frame-k0.Frame)
+	t = k0.Easing.Apply(t)
+
+	k := Keyframe{Frame: frame, Easing: k0.Easing}
+	k.Zoom = k0.Zoom * math.Pow(k1.Zoom/k0.Zoom, t)
+	// Moving the center in proportion to the width of the view keeps the
+	// speed across the screen constant while zooming.
+	s := t
+	if k0.Zoom != k1.Zoom {
+		s = (1/k.Zoom - 1/k0.Zoom) / (1/k1.Zoom - 1/k0.Zoom)
+	}
+	k.Center = k0.Center + (k1.Center-k0.Center)*complex(s, 0)
+	k.Rotation = k0.Rotation + (k1.Rotation-k0.Rotation)*t
+	k.JuliaConstant = k0.JuliaConstant + (k1.JuliaConstant-k0.JuliaConstant)*complex(t, 0)
+	k.ColorOffset = k0.ColorOffset + (k1.ColorOffset-k0.ColorOffset)*t
+	if k0.MaxIterations > 0 && k1.MaxIterations > 0 {
+		k.MaxIterations = int(float64(k0.MaxIterations) + float64(k1.MaxIterations-k0.MaxIterations)*t + 0.5)
+	}
+	return k
+}
+
+// Fractal returns the fractal and settings of a keyframe.
+func (a *Animation) Fractal(k Keyframe) (*fractal.Fractal, fractal.Settings) {
+	fr := fractal.NewMandelbrot()
+	if a.Julia {
+		fr = fractal.NewJulia(k.JuliaConstant)
+	}
+	fr.SetView(k.Center, k.Zoom, float64(a.Size.Height)/float64(a.Size.Width))
+	v := fr.Viewport()
+	v.Rotation = k.Rotation
+	fr.SetViewport(v)
+	s := a.Settings
+	s.ColorOffset = k.ColorOffset
+	if k.MaxIterations > 0 {
+		s.MaxIterations = k.MaxIterations
+	}
+	return fr, s
+}
+
+// Render renders a single frame.
+func (a *Animation) Render(frame int) (*image.RGBA, error) {
+	fr, s := a.Fractal(a.At(frame))
+	return render(fr, a.Size, s)
+}
+
+// render renders fr and colors the samples.
+func render(fr *fractal.Fractal, size graphic.Box, s fractal.Settings) (*image.RGBA, error) {
+	pixels, err := fr.Render(size, s)
+	if err != nil {
+		return nil, err
+	}
+	for range pixels {
+	}
+	return fr.Buffer().Image(s), nil
+}
+
+// Run renders the frames in order and calls f with each image. It stops
+// at the first error of a render or of f.
+func (a *Animation) Run(f func(frame int, img *image.RGBA) error) error {
+	if err := a.check(); err != nil {
+		return err
+	}
+	render := a.Render
+	if a.Accelerate && a.sameFractal() {
+		render = newAccelerator(a).frame
+	}
+	for i := 0; i < a.Frames(); i++ {
+		img, err := render(i)
+		if err != nil {
+			return err
+		}
+		if err := f(i, img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write renders the frames into w and closes it. progress is called
+// after each frame.
+func (a *Animation) Write(w graphic.FrameWriter, progress func(done float64)) error {
+	err := a.Run(func(i int, img *image.RGBA) error {
+		if err := w.WriteFrame(img); err != nil {
+			return err
+		}
+		progress(float64(i+1) / float64(a.Frames()))
+		return nil
+	})
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
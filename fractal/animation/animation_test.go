@@ -0,0 +1,96 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package animation
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	k0 := Keyframe{Frame: 0, Center: complex(-0.75, 0), Zoom: 1, MaxIterations: 100}
+	k1 := Keyframe{
+		Frame:         10,
+		Center:        complex(0.25, 1),
+		Zoom:          100,
+		Rotation:      math.Pi,
+		JuliaConstant: complex(0.5, -0.5),
+		ColorOffset:   1,
+		MaxIterations: 300,
+	}
+
+	k := interpolate(k0, k1, 5)
+	if k.Frame != 5 {
+		t.Errorf("frame %d, want 5", k.Frame)
+	}
+	// Halfway in time is halfway in magnitudes of the zoom.
+	if math.Abs(k.Zoom-10) > 1e-9 {
+		t.Errorf("zoom %g, want 10", k.Zoom)
+	}
+	// The center moves with the width of the view, 1/zoom.
+	s := (1/k.Zoom - 1) / (1/k1.Zoom - 1)
+	if want := k0.Center + (k1.Center-k0.Center)*complex(s, 0); cmplx.Abs(k.Center-want) > 1e-12 {
+		t.Errorf("center %v, want %v", k.Center, want)
+	}
+	if math.Abs(k.Rotation-math.Pi/2) > 1e-12 {
+		t.Errorf("rotation %g, want %g", k.Rotation, math.Pi/2)
+	}
+	if cmplx.Abs(k.JuliaConstant-complex(0.25, -0.25)) > 1e-12 {
+		t.Errorf("Julia constant %v, want (0.25-0.25i)", k.JuliaConstant)
+	}
+	if math.Abs(k.ColorOffset-0.5) > 1e-12 {
+		t.Errorf("color offset %g, want 0.5", k.ColorOffset)
+	}
+	if k.MaxIterations != 200 {
+		t.Errorf("iterations %d, want 200", k.MaxIterations)
+	}
+}
+
+func TestInterpolateEnds(t *testing.T) {
+	k0 := Keyframe{Frame: 0, Center: complex(-0.75, 0), Zoom: 1, Rotation: -1}
+	k1 := Keyframe{Frame: 10, Center: complex(0.25, 1), Zoom: 100, Rotation: 2}
+	for _, c := range []struct {
+		frame int
+		want  Keyframe
+	}{{0, k0}, {10, k1}} {
+		k := interpolate(k0, k1, c.frame)
+		if cmplx.Abs(k.Center-c.want.Center) > 1e-12 || math.Abs(k.Zoom-c.want.Zoom) > 1e-9 ||
+			math.Abs(k.Rotation-c.want.Rotation) > 1e-12 {
+			t.Errorf("frame %d: %+v, want %+v", c.frame, k, c.want)
+		}
+	}
+}
+
+func TestInterpolateSameZoom(t *testing.T) {
+	k0 := Keyframe{Frame: 0, Center: complex(0, 0), Zoom: 4}
+	k1 := Keyframe{Frame: 4, Center: complex(1, 2), Zoom: 4, Rotation: 1}
+	k := interpolate(k0, k1, 1)
+	if k.Zoom != 4 || cmplx.Abs(k.Center-complex(0.25, 0.5)) > 1e-12 || math.Abs(k.Rotation-0.25) > 1e-12 {
+		t.Errorf("got %+v", k)
+	}
+	// Keyframes without iterations keep those of the settings.
+	if k.MaxIterations != 0 {
+		t.Errorf("iterations %d, want 0", k.MaxIterations)
+	}
+}
+
+func TestSameFractal(t *testing.T) {
+	zoom := []Keyframe{{Frame: 0, Zoom: 1}, {Frame: 10, Center: complex(0.1, 0.2), Zoom: 8, Rotation: 1}}
+	for _, c := range []struct {
+		julia bool
+		k1    Keyframe
+		want  bool
+	}{
+		{false, zoom[1], true},
+		{false, Keyframe{Frame: 10, Zoom: 8, JuliaConstant: complex(0.3, 0)}, true},
+		{true, Keyframe{Frame: 10, Zoom: 8, JuliaConstant: complex(0.3, 0)}, false},
+		{false, Keyframe{Frame: 10, Zoom: 8, MaxIterations: 500}, false},
+	} {
+		a := &Animation{Julia: c.julia, Keyframes: []Keyframe{zoom[0], c.k1}}
+		if got := a.sameFractal(); got != c.want {
+			t.Errorf("Julia %v, %+v: sameFractal %v, want %v", c.julia, c.k1, got, c.want)
+		}
+	}
+}
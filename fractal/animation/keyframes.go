@@ -0,0 +1,104 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package animation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"saph/graphic/palette"
+)
+
+// keyframeJSON is the stored form of a Keyframe, with complex numbers as
+// pairs and the easing by name.
+type keyframeJSON struct {
+	Frame         int
+	Center        [2]float64
+	Zoom          float64
+	Rotation      float64    `json:",omitempty"`
+	JuliaConstant [2]float64 `json:",omitempty"`
+	ColorOffset   float64    `json:",omitempty"`
+	MaxIterations int        `json:",omitempty"`
+	Easing        string     `json:",omitempty"`
+}
+
+// ReadKeyframes reads a JSON list of keyframes:
+//
+//	[
+//		{"Frame": 0, "Center": [-0.75, 0], "Zoom": 1},
+//		{"Frame": 240, "Center": [-0.7435, 0.1314], "Zoom": 5000, "Rotation": 3.1416, "Easing": "Ease in-out"}
+//	]
+//
+// Rotation is in radians, counterclockwise, and 0 if left out.
+func ReadKeyframes(r io.Reader) ([]Keyframe, error) {
+	var stored []keyframeJSON
+	if err := json.NewDecoder(r).Decode(&stored); err != nil {
+		return nil, fmt.Errorf("animation: %v", err)
+	}
+	keyframes := make([]Keyframe, len(stored))
+	for i, s := range stored {
+		k := Keyframe{
+			Frame:         s.Frame,
+			Center:        complex(s.Center[0], s.Center[1]),
+			Zoom:          s.Zoom,
+			Rotation:      s.Rotation,
+			JuliaConstant: complex(s.JuliaConstant[0], s.JuliaConstant[1]),
+			ColorOffset:   s.ColorOffset,
+			MaxIterations: s.MaxIterations,
+		}
+		if s.Easing != "" {
+			var err error
+			if k.Easing, err = palette.ParseEasing(s.Easing); err != nil {
+				return nil, err
+			}
+		}
+		keyframes[i] = k
+	}
+	return keyframes, nil
+}
+
+// morphJSON is the stored form of a Morph.
+type morphJSON struct {
+	Kind       string
+	Points     [][2]float64
+	Radius     float64
+	Start, End float64
+	Frames     int
+	Easing     string
+}
+
+// ReadMorph reads a morph stored as JSON:
+//
+//	{"Kind": "Cardioid", "Radius": 0.98, "Frames": 300}
+//	{"Kind": "Bezier", "Points": [[-0.8, 0.156], [0, 1], [0.3, 0.5]], "Frames": 120, "Easing": "Ease in-out"}
+func ReadMorph(r io.Reader) (Morph, error) {
+	var stored morphJSON
+	if err := json.NewDecoder(r).Decode(&stored); err != nil {
+		return Morph{}, fmt.Errorf("animation: %v", err)
+	}
+	m := Morph{
+		Path:   Path{Radius: stored.Radius, Start: stored.Start, End: stored.End},
+		Frames: stored.Frames,
+	}
+	kind := -1
+	for i, name := range pathKindNames {
+		if name == stored.Kind {
+			kind = i
+		}
+	}
+	if kind < 0 {
+		return m, fmt.Errorf("animation: unknown path %q", stored.Kind)
+	}
+	m.Path.Kind = PathKind(kind)
+	for _, p := range stored.Points {
+		m.Path.Points = append(m.Path.Points, complex(p[0], p[1]))
+	}
+	if stored.Easing != "" {
+		var err error
+		if m.Easing, err = palette.ParseEasing(stored.Easing); err != nil {
+			return m, err
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,150 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package animation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"saph/graphic/palette"
+)
+
+// PathKind selects the shape of a Path.
+type PathKind int
+
+const (
+	// LinePath runs through its points along straight lines at an even
+	// speed.
+	LinePath PathKind = iota
+	// CirclePath runs around the circle of Radius around its point.
+	CirclePath
+	// BezierPath is the Bézier curve of its control points.
+	BezierPath
+	// CardioidPath follows the boundary of the main cardioid of the
+	// Mandelbrot set, or with a Radius other than 1 a curve inside or
+	// outside it. The bulbs on the cardioid are not followed, so it only
+	// approximates the boundary of the Mandelbrot set.
+	CardioidPath
+)
+
+var pathKindNames = []string{"Line", "Circle", "Bezier", "Cardioid"}
+
+func (k PathKind) String() string {
+	if k < 0 || int(k) >= len(pathKindNames) {
+		return fmt.Sprintf("PathKind(%d)", int(k))
+	}
+	return pathKindNames[k]
+}
+
+// Path is a curve in the complex plane, parametrized over [0, 1].
+type Path struct {
+	Kind   PathKind
+	Points []complex128
+	Radius float64
+	// Start and End are the angles of circles and cardioids in turns,
+	// counterclockwise from the positive real axis. Equal angles make a
+	// whole turn.
+	Start, End float64
+}
+
+func (p Path) check() error {
+	switch p.Kind {
+	case LinePath, BezierPath:
+		if len(p.Points) < 2 {
+			return fmt.Errorf("animation: %s path needs two points", p.Kind)
+		}
+	case CirclePath:
+		if len(p.Points) != 1 {
+			return errors.New("animation: Circle path needs its center point")
+		}
+		if p.Radius <= 0 {
+			return errors.New("animation: Circle path needs a positive radius")
+		}
+	case CardioidPath:
+		if p.Radius <= 0 {
+			return errors.New("animation: Cardioid path needs a positive radius")
+		}
+	default:
+		return fmt.Errorf("animation: unknown path %v", p.Kind)
+	}
+	return nil
+}
+
+// At is the point at t, 0 <= t <= 1, of the path.
+func (p Path) At(t float64) complex128 {
+	switch p.Kind {
+	case LinePath:
+		return p.lineAt(t)
+	case CirclePath:
+		return p.Points[0] + cmplx.Rect(p.Radius, p.angle(t))
+	case BezierPath:
+		// De Casteljau's algorithm.
+		points := append([]complex128(nil), p.Points...)
+		for n := len(points) - 1; n > 0; n-- {
+			for i := 0; i < n; i++ {
+				points[i] += (points[i+1] - points[i]) * complex(t, 0)
+			}
+		}
+		return points[0]
+	case CardioidPath:
+		// The multiplier of the fixed point of z² + c.
+		mu := cmplx.Rect(p.Radius, p.angle(t))
+		return mu/2 - mu*mu/4
+	}
+	return 0
+}
+
+func (p Path) angle(t float64) float64 {
+	end := p.End
+	if end == p.Start {
+		end = p.Start + 1
+	}
+	return 2 * math.Pi * (p.Start + (end-p.Start)*t)
+}
+
+func (p Path) lineAt(t float64) complex128 {
+	var length float64
+	for i := 1; i < len(p.Points); i++ {
+		length += cmplx.Abs(p.Points[i] - p.Points[i-1])
+	}
+	d := t * length
+	for i := 1; i < len(p.Points); i++ {
+		segment := cmplx.Abs(p.Points[i] - p.Points[i-1])
+		if d <= segment && segment > 0 {
+			return p.Points[i-1] + (p.Points[i]-p.Points[i-1])*complex(d/segment, 0)
+		}
+		d -= segment
+	}
+	return p.Points[len(p.Points)-1]
+}
+
+// Morph sweeps the Julia constant along a path over a number of frames.
+type Morph struct {
+	Path   Path
+	Frames int
+	Easing palette.Easing // of the speed along the path
+}
+
+// Keyframes returns a keyframe per frame of the morph, all viewed at
+// center and zoom. Render them as a Julia Animation.
+func (m Morph) Keyframes(center complex128, zoom float64) ([]Keyframe, error) {
+	if err := m.Path.check(); err != nil {
+		return nil, err
+	}
+	if m.Frames < 2 {
+		return nil, errors.New("animation: a morph needs two frames")
+	}
+	keyframes := make([]Keyframe, m.Frames)
+	for i := range keyframes {
+		t := m.Easing.Apply(float64(i) / float64(m.Frames-1))
+		keyframes[i] = Keyframe{
+			Frame:         i,
+			Center:        center,
+			Zoom:          zoom,
+			JuliaConstant: m.Path.At(t),
+		}
+	}
+	return keyframes, nil
+}
@@ -0,0 +1,104 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package animation
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestPathAt(t *testing.T) {
+	line := Path{Kind: LinePath, Points: []complex128{0, 1, complex(1, 3)}}
+	circle := Path{Kind: CirclePath, Points: []complex128{complex(1, 1)}, Radius: 0.5}
+	arc := Path{Kind: CirclePath, Points: []complex128{0}, Radius: 1, Start: 0.25, End: 0.5}
+	bezier := Path{Kind: BezierPath, Points: []complex128{0, complex(1, 2), 2}}
+	cardioid := Path{Kind: CardioidPath, Radius: 1}
+	for _, c := range []struct {
+		name string
+		p    Path
+		t    float64
+		want complex128
+	}{
+		// The line is 4 long, so its points are spread by length.
+		{"line start", line, 0, 0},
+		{"line first segment", line, 0.125, 0.5},
+		{"line corner", line, 0.25, 1},
+		{"line second segment", line, 0.625, complex(1, 1.5)},
+		{"line end", line, 1, complex(1, 3)},
+		{"circle start", circle, 0, complex(1.5, 1)},
+		{"circle quarter", circle, 0.25, complex(1, 1.5)},
+		{"circle end", circle, 1, complex(1.5, 1)},
+		{"arc start", arc, 0, complex(0, 1)},
+		{"arc end", arc, 1, -1},
+		{"bezier start", bezier, 0, 0},
+		{"bezier middle", bezier, 0.5, complex(1, 1)},
+		{"bezier end", bezier, 1, 2},
+		// The cusp and the tip of the main cardioid.
+		{"cardioid cusp", cardioid, 0, 0.25},
+		{"cardioid tip", cardioid, 0.5, -0.75},
+	} {
+		if got := c.p.At(c.t); cmplx.Abs(got-c.want) > 1e-12 {
+			t.Errorf("%s: At(%g) = %v, want %v", c.name, c.t, got, c.want)
+		}
+	}
+}
+
+// The constants of a cardioid path of radius 1 have a neutral fixed point.
+func TestCardioidBoundary(t *testing.T) {
+	p := Path{Kind: CardioidPath, Radius: 1}
+	for i := 0; i < 16; i++ {
+		c := p.At(float64(i) / 16)
+		// The fixed points of z² + c are (1 ± sqrt(1 - 4c)) / 2, with
+		// multipliers 2z.
+		z := (1 - cmplx.Sqrt(1-4*c)) / 2
+		if d := math.Abs(cmplx.Abs(2*z) - 1); d > 1e-9 {
+			t.Errorf("At(%g) = %v: multiplier off the unit circle by %g", float64(i)/16, c, d)
+		}
+	}
+}
+
+func TestPathCheck(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		p    Path
+		ok   bool
+	}{
+		{"line", Path{Kind: LinePath, Points: []complex128{0, 1}}, true},
+		{"line of one point", Path{Kind: LinePath, Points: []complex128{0}}, false},
+		{"bezier of one point", Path{Kind: BezierPath, Points: []complex128{0}}, false},
+		{"circle", Path{Kind: CirclePath, Points: []complex128{0}, Radius: 0.5}, true},
+		{"circle without center", Path{Kind: CirclePath, Radius: 0.5}, false},
+		{"circle without radius", Path{Kind: CirclePath, Points: []complex128{0}}, false},
+		{"circle of negative radius", Path{Kind: CirclePath, Points: []complex128{0}, Radius: -1}, false},
+		{"cardioid", Path{Kind: CardioidPath, Radius: 0.98}, true},
+		{"cardioid without radius", Path{Kind: CardioidPath}, false},
+		{"unknown", Path{Kind: PathKind(7), Radius: 1}, false},
+	} {
+		if err := c.p.check(); (err == nil) != c.ok {
+			t.Errorf("%s: check() = %v", c.name, err)
+		}
+	}
+}
+
+func TestMorphKeyframes(t *testing.T) {
+	m := Morph{Path: Path{Kind: LinePath, Points: []complex128{0, 1}}, Frames: 5}
+	keyframes, err := m.Keyframes(complex(0.5, 0), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyframes) != 5 {
+		t.Fatalf("%d keyframes, want 5", len(keyframes))
+	}
+	for i, k := range keyframes {
+		want := complex(float64(i)/4, 0)
+		if k.Frame != i || k.Center != complex(0.5, 0) || k.Zoom != 2 || cmplx.Abs(k.JuliaConstant-want) > 1e-12 {
+			t.Errorf("keyframe %d: %+v, want constant %v", i, k, want)
+		}
+	}
+	m.Frames = 1
+	if _, err := m.Keyframes(0, 1); err == nil {
+		t.Error("morph of one frame accepted")
+	}
+}
@@ -0,0 +1,178 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"saph/graphic"
+	"sync"
+)
+
+// Sample is the escape data of a single point: the number of iterations,
+// the orbit value at escape, the distance estimate to the set and the
+// closest approach of the orbit to the orbit trap.
+type Sample struct {
+	N    int32
+	Z    complex64
+	DE   float32
+	Trap float32
+}
+
+// smooth is the continuous iteration count of an escaped sample. Samples
+// that escaped with |z| <= 1, as they do for bailout radii of 1 or less,
+// have no smooth count and keep their iteration count.
+func (s Sample) smooth() float64 {
+	zAbs := math.Sqrt(float64(real(s.Z)*real(s.Z) + imag(s.Z)*imag(s.Z)))
+	corr := math.Log10(math.Log10(zAbs)) / math.Log10(2.0)
+	if math.IsNaN(corr) || math.IsInf(corr, 0) {
+		return float64(s.N)
+	}
+	return float64(s.N) - corr
+}
+
+// Buffer holds the samples of a render, row by row, with SampleRatio²
+// samples per pixel. It allows an image to be recolored or post-processed
+// without iterating the fractal again.
+type Buffer struct {
+	graphic.Box
+	SampleRatio   int
+	MaxIterations int
+	PixelSize     float64 // width of a pixel in the complex plane
+	Samples       []Sample
+	iteration     iteration
+}
+
+// iteration is what the samples of a render depend on besides the
+// positions of the pixels, the sample ratio and the iteration limit.
+type iteration struct {
+	isMandelbrot     bool
+	juliaConstant    complex128
+	bailout          float64
+	trap             complex128 // zero without an orbit trap layer
+	hasTrap          bool
+	colStep, rowStep complex128 // see Viewport.steps
+}
+
+func newBuffer(imageSize graphic.Box, settings Settings, pixelSize float64) *Buffer {
+	ratio := settings.SampleRatio
+	if ratio < 1 {
+		ratio = 1
+	}
+	return &Buffer{
+		Box:           imageSize,
+		SampleRatio:   ratio,
+		MaxIterations: settings.MaxIterations,
+		PixelSize:     pixelSize,
+		Samples:       make([]Sample, imageSize.Width*imageSize.Height*ratio*ratio),
+	}
+}
+
+// pixel returns the samples of the pixel at x, y.
+func (b *Buffer) pixel(x, y int) []Sample {
+	n := b.SampleRatio * b.SampleRatio
+	i := (y*b.Width + x) * n
+	return b.Samples[i : i+n]
+}
+
+// inside reports whether all samples of the pixel at x, y belong to the set.
+func (b *Buffer) inside(x, y int) bool {
+	for _, s := range b.pixel(x, y) {
+		if int(s.N) != b.MaxIterations {
+			return false
+		}
+	}
+	return true
+}
+
+// height is the mean continuous iteration count of the escaped samples
+// of the pixel at x, y.
+func (b *Buffer) height(x, y int) float64 {
+	var sum float64
+	var count int
+	for _, s := range b.pixel(x, y) {
+		if int(s.N) != b.MaxIterations {
+			sum += s.smooth()
+			count++
+		}
+	}
+	if count == 0 {
+		return float64(b.MaxIterations)
+	}
+	return sum / float64(count)
+}
+
+// Image colors the buffer with the given settings. The iteration settings
+// of the render that produced the buffer are kept.
+func (b *Buffer) Image(settings Settings) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, b.Width, b.Height))
+	b.color(settings, func(x, y int, c color.RGBA) {
+		img.SetRGBA(x, y, c)
+	})
+	return img
+}
+
+// Image64 is Image with 16 bits per channel.
+func (b *Buffer) Image64(settings Settings) *image.RGBA64 {
+	img := image.NewRGBA64(image.Rect(0, 0, b.Width, b.Height))
+	b.colorFloat(settings, func(x, y int, c rgb) {
+		img.SetRGBA64(x, y, c.RGBA64())
+	})
+	return img
+}
+
+// FloatImage is Image with the colors kept in floating point.
+func (b *Buffer) FloatImage(settings Settings) *graphic.FloatImage {
+	img := graphic.NewFloatImage(image.Rect(0, 0, b.Width, b.Height))
+	b.colorFloat(settings, func(x, y int, c rgb) {
+		img.SetRGB(x, y, float32(c[0]), float32(c[1]), float32(c[2]))
+	})
+	return img
+}
+
+// stream sends the colored pixels of the buffer to pixChan.
+func (b *Buffer) stream(rs *renderSettings, pixChan chan graphic.Pixel) {
+	b.color(rs.Settings, func(x, y int, c color.RGBA) {
+		pixChan <- graphic.Pix(c, x, y)
+	})
+}
+
+func (b *Buffer) color(settings Settings, f func(x, y int, c color.RGBA)) {
+	b.colorFloat(settings, func(x, y int, c rgb) {
+		f(x, y, c.RGBA())
+	})
+}
+
+// colorFloat colors the pixels of the buffer concurrently, row by row.
+func (b *Buffer) colorFloat(settings Settings, f func(x, y int, c rgb)) {
+	settings.MaxIterations = b.MaxIterations
+	settings.SampleRatio = b.SampleRatio
+	rs := newRenderSettings(b.Box, settings)
+	wg := new(sync.WaitGroup)
+	for y := 0; y < b.Height; y++ {
+		wg.Add(1)
+		go func(y int) {
+			for x := 0; x < b.Width; x++ {
+				f(x, y, rs.compose(b, x, y))
+			}
+			wg.Done()
+		}(y)
+	}
+	wg.Wait()
+}
+
+// Cycle colors the buffer frames times while the palette is rotated one
+// whole turn, starting at the offset of settings, and calls f with each
+// image. It stops at the first error returned by f.
+func (b *Buffer) Cycle(settings Settings, frames int, f func(frame int, img *image.RGBA) error) error {
+	start := settings.ColorOffset
+	for i := 0; i < frames; i++ {
+		settings.ColorOffset = start + float64(i)/float64(frames)
+		if err := f(i, b.Image(settings)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const checkpointInfoFile = "checkpoint.json"
+
+// checkpoint keeps the samples of finished poster strips in a directory,
+// so that an interrupted poster can be resumed where it stopped.
+type checkpoint struct {
+	dir string
+}
+
+// openCheckpoint opens the checkpoint directory of the render described by
+// info, creating it if needed. A directory left by another render is an
+// error rather than being overwritten.
+func openCheckpoint(dir string, info []byte) (*checkpoint, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	name := filepath.Join(dir, checkpointInfoFile)
+	old, err := ioutil.ReadFile(name)
+	switch {
+	case os.IsNotExist(err):
+		if err := ioutil.WriteFile(name, info, 0644); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case !bytes.Equal(old, info):
+		return nil, fmt.Errorf("fractal: checkpoint %s belongs to another render", dir)
+	}
+	return &checkpoint{dir}, nil
+}
+
+func (c *checkpoint) stripFile(top int) string {
+	return filepath.Join(c.dir, fmt.Sprintf("strip%09d", top))
+}
+
+// strips returns the first rows of the strips in the checkpoint.
+func (c *checkpoint) strips() []int {
+	names, _ := filepath.Glob(filepath.Join(c.dir, "strip[0-9]*"))
+	var tops []int
+	for _, name := range names {
+		var top int
+		if _, err := fmt.Sscanf(filepath.Base(name), "strip%09d", &top); err == nil && name == c.stripFile(top) {
+			tops = append(tops, top)
+		}
+	}
+	return tops
+}
+
+// load reads the samples of the strip starting at row top. It reports
+// false if the strip is not in the checkpoint.
+func (c *checkpoint) load(top int, samples []Sample) bool {
+	file, err := os.Open(c.stripFile(top))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	return binary.Read(bufio.NewReader(file), binary.LittleEndian, samples) == nil
+}
+
+// save writes the samples of the strip starting at row top. The strip
+// only appears in the checkpoint once it is completely written.
+func (c *checkpoint) save(top int, samples []Sample) error {
+	name := c.stripFile(top)
+	if err := writeSamples(name+".tmp", samples); err != nil {
+		os.Remove(name + ".tmp")
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		os.Remove(name + ".tmp")
+		return err
+	}
+	return nil
+}
+
+func writeSamples(name string, samples []Sample) error {
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := binary.Write(w, binary.LittleEndian, samples); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// remove deletes the files of the checkpoint, and the directory if it is
+// left empty.
+func (c *checkpoint) remove() error {
+	for _, top := range c.strips() {
+		if err := os.Remove(c.stripFile(top)); err != nil {
+			return err
+		}
+	}
+	// Strips whose writing was interrupted.
+	temps, _ := filepath.Glob(filepath.Join(c.dir, "strip[0-9]*.tmp"))
+	for _, name := range temps {
+		if err := os.Remove(name); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(filepath.Join(c.dir, checkpointInfoFile)); err != nil {
+		return err
+	}
+	os.Remove(c.dir)
+	return nil
+}
@@ -0,0 +1,101 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"saph/graphic"
+	"testing"
+)
+
+// failingWriter fails once n bytes are written.
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		n := w.n
+		w.n = 0
+		return n, errors.New("disk full")
+	}
+	w.n -= len(b)
+	return len(b), nil
+}
+
+// An interrupted poster resumes from its checkpoint, gives the same PNG as
+// an uninterrupted one and removes the checkpoint when done.
+func TestPosterCheckpoint(t *testing.T) {
+	root, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "poster")
+
+	fr, s := testFractal(), testSettings()
+	poster := Poster{Box: graphic.Box{Width: 12, Height: 9}}
+	var want bytes.Buffer
+	if err := fr.EncodePoster(&want, poster, s); err != nil {
+		t.Fatal(err)
+	}
+
+	poster.Checkpoint = dir
+	// Fail at the end, once all rows are read.
+	if err := fr.EncodePoster(&failingWriter{n: want.Len() - 1}, poster, s); err == nil {
+		t.Fatal("EncodePoster succeeded with a failing writer")
+	}
+	c := &checkpoint{dir}
+	if tops := c.strips(); len(tops) != 1 || tops[0] != 0 {
+		t.Fatalf("checkpoint holds strips %v, want [0]", tops)
+	}
+	// A strip whose writing was interrupted.
+	if err := ioutil.WriteFile(c.stripFile(9)+".tmp", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []float64
+	poster.Progress = func(done float64) { progress = append(progress, done) }
+	var got bytes.Buffer
+	if err := fr.EncodePoster(&got, poster, s); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Error("resumed poster differs from an uninterrupted one")
+	}
+	if len(progress) == 0 || progress[0] != 1 {
+		t.Errorf("progress %v, want it to start at 1", progress)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("checkpoint not removed: %v", err)
+	}
+}
+
+func TestCheckpointOfAnotherRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fr, s := testFractal(), testSettings()
+	poster := Poster{Box: graphic.Box{Width: 12, Height: 9}, Checkpoint: dir}
+	if err := fr.EncodePoster(&failingWriter{n: 0}, poster, s); err == nil {
+		t.Fatal("EncodePoster succeeded with a failing writer")
+	}
+	if _, err := os.Stat(filepath.Join(dir, checkpointInfoFile)); err != nil {
+		t.Fatal(err)
+	}
+	s.MaxIterations++
+	if err := fr.EncodePoster(new(bytes.Buffer), poster, s); err == nil {
+		t.Error("EncodePoster used the checkpoint of other settings")
+	}
+	poster.Width++
+	s.MaxIterations--
+	if err := fr.EncodePoster(new(bytes.Buffer), poster, s); err == nil {
+		t.Error("EncodePoster used the checkpoint of another size")
+	}
+}
@@ -0,0 +1,120 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"image/color"
+	"math"
+	"saph/graphic/palette"
+)
+
+// Decomposition selects colorings derived from the angle of the orbit at
+// escape. The flags can be combined with each other and are applied on top
+// of the escape-time palette color.
+type Decomposition uint
+
+const (
+	// BinaryDecomposition darkens points that escape with Im z < 0,
+	// revealing the grid of cells around the set.
+	BinaryDecomposition Decomposition = 1 << iota
+	// AngleDecomposition sets the hue of the palette color from the
+	// continuous angle of z at escape.
+	AngleDecomposition
+	// FieldLines overlays the field lines (external rays) as dark lines.
+	FieldLines
+)
+
+const (
+	fieldLineCount = 8    // field lines per cell
+	fieldLineWidth = 0.08 // fraction of the distance between two lines
+)
+
+// colorize maps the escape data of a point to a color of a palette layer.
+func (rs *renderSettings) colorize(s Sample, l *Layer) rgb {
+	if int(s.N) == rs.MaxIterations {
+		return toRGB(l.SetColor)
+	}
+
+	z := complex128(s.Z)
+	c := rs.paletteColor(s, l.Palette)
+	if rs.Decomposition == 0 {
+		return c
+	}
+
+	// Angle of z at escape, as a fraction of a full turn in [0, 1).
+	angle := math.Atan2(imag(z), real(z))/(2*math.Pi) + 0.5
+	if rs.Decomposition&AngleDecomposition != 0 {
+		_, _, v := palette.RGBToHSV(c[0], c[1], c[2])
+		c[0], c[1], c[2] = palette.HSVToRGB(angle, 1, v)
+	}
+	if rs.Decomposition&BinaryDecomposition != 0 && imag(z) < 0 {
+		c = c.scale(0.5)
+	}
+	if rs.Decomposition&FieldLines != 0 {
+		f := angle * fieldLineCount
+		f -= math.Floor(f)
+		if f < fieldLineWidth/2 || f > 1-fieldLineWidth/2 {
+			c = c.scale(0.2)
+		}
+	}
+	return c
+}
+
+// paletteColor is the escape-time coloring, optionally smoothed by the
+// magnitude of z at escape.
+func (rs *renderSettings) paletteColor(s Sample, p palette.Palette) rgb {
+	var v float64
+	if rs.Normalize {
+		v = s.smooth() * rs.ColorFrequency
+	} else {
+		v = float64(s.N) * math.Trunc(rs.ColorFrequency)
+	}
+	offset := rs.ColorOffset - math.Floor(rs.ColorOffset)
+	return paletteAt(p, v+offset*float64(len(p)))
+}
+
+// paletteAt interpolates the cyclic palette p at the continuous index v,
+// so that smooth colorings do not band between palette entries. Indices
+// that are not finite give the first entry.
+func paletteAt(p palette.Palette, v float64) rgb {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		v = 0
+	}
+	n := len(p)
+	i := math.Floor(v)
+	f := v - i
+	j := int(math.Mod(i, float64(n)))
+	if j < 0 {
+		j += n
+	}
+	a, b := toRGB(p[j]), toRGB(p[(j+1)%n])
+	for k := range a {
+		a[k] += (b[k] - a[k]) * f
+	}
+	return a
+}
+
+// QuantizationPalette returns at most n colors for paletted images of
+// renders with the settings: the set colors and evenly spaced entries of
+// the palettes of the palette layers.
+func (s Settings) QuantizationPalette(n int) color.Palette {
+	var p color.Palette
+	var palettes []palette.Palette
+	for _, l := range s.Layers {
+		if l.Kind == PaletteLayer && len(p) < n {
+			p = append(p, l.SetColor)
+			palettes = append(palettes, l.Palette)
+		}
+	}
+	if len(palettes) == 0 {
+		return p
+	}
+	per := (n - len(p)) / len(palettes)
+	for _, pal := range palettes {
+		for i := 0; i < per; i++ {
+			p = append(p, pal[i*len(pal)/per])
+		}
+	}
+	return p
+}
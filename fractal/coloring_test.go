@@ -0,0 +1,183 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"saph/graphic"
+	"saph/graphic/palette"
+	"testing"
+)
+
+func TestPaletteAt(t *testing.T) {
+	p := palette.Palette{{0, 0, 0, 255}, {255, 255, 255, 255}}
+	black, white, grey := rgb{0, 0, 0}, rgb{1, 1, 1}, rgb{0.5, 0.5, 0.5}
+	for _, test := range []struct {
+		v    float64
+		want rgb
+	}{
+		{0, black},
+		{1, white},
+		{0.5, grey},
+		{2, black},
+		{-1, white},
+		{-0.5, grey},
+		{1e18 + 1, black},
+		{math.NaN(), black},
+		{math.Inf(1), black},
+		{math.Inf(-1), black},
+	} {
+		if got := paletteAt(p, test.v); got != test.want {
+			t.Errorf("paletteAt(%v) = %v, want %v", test.v, got, test.want)
+		}
+	}
+}
+
+func TestSmoothInsideUnitCircle(t *testing.T) {
+	for _, z := range []complex64{0, 0.5, 1, complex(0.6, 0.8)} {
+		s := Sample{N: 7, Z: z}
+		if got := s.smooth(); got != 7 {
+			t.Errorf("smooth of |z| = %v: got %v, want 7", z, got)
+		}
+	}
+}
+
+func TestDecomposition(t *testing.T) {
+	l := NewPaletteLayer(palette.Palette{{0x80, 0x80, 0x80, 0xFF}}, palette.Red)
+	grey := toRGB(l.Palette[0])
+	hue := func(h float64) rgb {
+		r, g, b := palette.HSVToRGB(h, 1, grey[0])
+		return rgb{r, g, b}
+	}
+	for _, c := range []struct {
+		d    Decomposition
+		s    Sample
+		want rgb
+	}{
+		{0, Sample{N: 5, Z: complex(3, -1)}, grey},
+		{BinaryDecomposition, Sample{N: 5, Z: complex(3, 1)}, grey},
+		{BinaryDecomposition, Sample{N: 5, Z: complex(3, -1)}, grey.scale(0.5)},
+		// Straight up is three quarters of a turn from the negative axis,
+		// and on a field line.
+		{AngleDecomposition, Sample{N: 5, Z: complex(0, 3)}, hue(0.75)},
+		{FieldLines, Sample{N: 5, Z: complex(0, 3)}, grey.scale(0.2)},
+		{FieldLines, Sample{N: 5, Z: complex(3, 1)}, grey},
+		{AngleDecomposition | BinaryDecomposition | FieldLines, Sample{N: 5, Z: complex(0, -3)},
+			hue(0.25).scale(0.5 * 0.2)},
+		// The set keeps its color.
+		{BinaryDecomposition | FieldLines, Sample{N: 50, Z: complex(0, -3)}, toRGB(palette.Red)},
+	} {
+		s := Settings{MaxIterations: 50, BailoutRadius: 2, SampleRatio: 1, ColorFrequency: 1, Decomposition: c.d}
+		rs := newRenderSettings(graphic.Box{Width: 1, Height: 1}, s)
+		if got := rs.colorize(c.s, &l); got.RGBA() != c.want.RGBA() {
+			t.Errorf("decomposition %b of %v: got %v, want %v", c.d, c.s.Z, got.RGBA(), c.want.RGBA())
+		}
+	}
+}
+
+func TestRenderCheck(t *testing.T) {
+	p := palette.Palette{palette.Black, palette.White}
+	valid := Settings{
+		MaxIterations: 50,
+		BailoutRadius: 2,
+		SampleRatio:   1,
+		Layers: []Layer{
+			NewPaletteLayer(p, color.RGBA{}),
+			NewOrbitTrapLayer(p, 0.5, 0.5),
+			NewOrbitTrapLayer(p, 0.5, 1),
+			NewGlowLayer(palette.White, 4),
+		},
+	}
+	for _, c := range []struct {
+		name   string
+		change func(s *Settings)
+	}{
+		{"no iterations", func(s *Settings) { s.MaxIterations = 0 }},
+		{"sample ratio", func(s *Settings) { s.SampleRatio = minSampleRatio - 1 }},
+		// Orbits escaping within the unit circle have no smooth coloring.
+		{"bailout", func(s *Settings) { s.BailoutRadius = 1 }},
+		{"NaN bailout", func(s *Settings) { s.BailoutRadius = math.NaN() }},
+		{"opacity", func(s *Settings) { s.Layers[0].Opacity = 1.5 }},
+		{"palette", func(s *Settings) { s.Layers[0].Palette = nil }},
+		{"trap palette", func(s *Settings) { s.Layers[1].Palette = palette.Palette{} }},
+		{"trap width", func(s *Settings) { s.Layers[1].Width = 0 }},
+		{"glow width", func(s *Settings) { s.Layers[3].Width = -1 }},
+		{"trap points", func(s *Settings) { s.Layers[2].Trap = 1i }},
+	} {
+		s := valid
+		s.Layers = append([]Layer(nil), valid.Layers...)
+		c.change(&s)
+		if _, err := NewMandelbrot().Render(graphic.Box{Width: 4, Height: 3}, s); err == nil {
+			t.Errorf("%s: Render succeeded", c.name)
+		}
+	}
+	if n := count(NewMandelbrot().Render(graphic.Box{Width: 4, Height: 3}, valid)); n != 12 {
+		t.Errorf("valid settings: Render sent %d pixels, want 12", n)
+	}
+}
+
+// Recoloring a buffer leaves out the layers that cannot be drawn.
+func TestImageSkipsBrokenLayers(t *testing.T) {
+	size := graphic.Box{Width: 8, Height: 6}
+	s := Settings{
+		MaxIterations: 50,
+		BailoutRadius: 2,
+		SampleRatio:   1,
+		Layers:        []Layer{NewPaletteLayer(palette.Palette{palette.Red}, palette.Red)},
+	}
+	fr := NewMandelbrot()
+	count(fr.Render(size, s))
+	want := fr.Buffer().Image(s)
+	s.Layers = append(s.Layers, NewGlowLayer(palette.White, 0), NewOrbitTrapLayer(nil, 0, 1))
+	if got := fr.Buffer().Image(s); string(got.Pix) != string(want.Pix) {
+		t.Error("broken layers changed the image")
+	}
+}
+
+// Cycling rotates the palette one turn from the offset of the settings and
+// stops at the first error.
+func TestCycle(t *testing.T) {
+	size := graphic.Box{Width: 8, Height: 6}
+	s := Settings{
+		MaxIterations:  50,
+		BailoutRadius:  2,
+		SampleRatio:    1,
+		ColorFrequency: 1,
+		ColorOffset:    0.5,
+		Layers:         []Layer{NewPaletteLayer(palette.Palette{palette.Red, palette.Green, palette.Blue}, palette.Black)},
+	}
+	fr := NewMandelbrot()
+	count(fr.Render(size, s))
+	b := fr.Buffer()
+
+	var frames []string
+	err := b.Cycle(s, 4, func(frame int, img *image.RGBA) error {
+		frames = append(frames, string(img.Pix))
+		want := s
+		want.ColorOffset = 0.5 + float64(frame)/4
+		if string(img.Pix) != string(b.Image(want).Pix) {
+			t.Errorf("frame %d is not colored with offset %g", frame, want.ColorOffset)
+		}
+		return nil
+	})
+	if err != nil || len(frames) != 4 {
+		t.Fatalf("Cycle colored %d frames with error %v, want 4 frames", len(frames), err)
+	}
+	if frames[0] == frames[1] {
+		t.Error("the palette did not turn between frames")
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = b.Cycle(s, 4, func(frame int, img *image.RGBA) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("Cycle colored %d frames with error %v, want 1 frame with %v", n, err, stop)
+	}
+}
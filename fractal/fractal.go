@@ -4,27 +4,27 @@
 package fractal
 
 import (
+	"fmt"
 	"image"
-	"image/color"
 	"math"
+	"math/cmplx"
 	"saph/graphic"
-	"saph/graphic/palette"
+	"strings"
 	"sync"
 )
 
 type Fractal struct {
-	xMin, yMin    float64
-	xMax, yMax    float64
+	view          Viewport
 	isMandelbrot  bool
 	juliaConstant complex128
+	buffer        *Buffer
 	progress
 	sync.Mutex
 }
 
 func NewMandelbrot() *Fractal {
 	fr := new(Fractal)
-	fr.xMin, fr.yMin = -2.5, -1.5
-	fr.xMax, fr.yMax = 1.0, 1.5
+	fr.view = Bounds{-2.5, -1.5, 1.0, 1.5}.Viewport()
 	fr.isMandelbrot = true
 	fr.juliaConstant = complex(0, 0)
 	fr.isFinished = true
@@ -33,69 +33,175 @@ func NewMandelbrot() *Fractal {
 
 func NewJulia(c complex128) *Fractal {
 	fr := new(Fractal)
-	fr.xMin, fr.yMin = -1.7, -1.0
-	fr.xMax, fr.yMax = 1.7, 1.0
+	fr.view = Bounds{-1.7, -1.0, 1.7, 1.0}.Viewport()
 	fr.isMandelbrot = false
 	fr.juliaConstant = c
 	fr.isFinished = true
 	return fr
 }
 
+// NewFormula returns the default view of the named formula, Mandelbrot or
+// Julia in any case. c is the Julia constant.
+func NewFormula(name string, c complex128) (*Fractal, error) {
+	switch {
+	case strings.EqualFold(name, "Mandelbrot"):
+		return NewMandelbrot(), nil
+	case strings.EqualFold(name, "Julia"):
+		return NewJulia(c), nil
+	}
+	return nil, fmt.Errorf("fractal: unknown formula %q", name)
+}
+
 func (fr *Fractal) IsMandelbrot() bool        { return fr.isMandelbrot }
 func (fr *Fractal) JuliaConstant() complex128 { return fr.juliaConstant }
 
+// Bounds is the rectangle of the complex plane covered by the image.
+type Bounds struct {
+	XMin, YMin float64
+	XMax, YMax float64
+}
+
+// Bounds returns the rectangle of the view before it is rotated.
+func (fr *Fractal) Bounds() Bounds { return fr.Viewport().Bounds() }
+
+// SetBounds moves the view to b, keeping its rotation.
+func (fr *Fractal) SetBounds(b Bounds) {
+	fr.Lock()
+	defer fr.Unlock()
+	rotation := fr.view.Rotation
+	fr.view = b.Viewport()
+	fr.view.Rotation = rotation
+}
+
+func (fr *Fractal) Viewport() Viewport {
+	fr.Lock()
+	defer fr.Unlock()
+	return fr.view
+}
+
+func (fr *Fractal) SetViewport(v Viewport) {
+	fr.Lock()
+	defer fr.Unlock()
+	fr.view = v
+}
+
+// SetView centers the default view of the fractal on center, magnified
+// zoom times. The height of the view is aspect times its width. The
+// rotation is kept.
+func (fr *Fractal) SetView(center complex128, zoom, aspect float64) {
+	def, _ := NewFormula(fr.formula(), 0)
+	fr.Lock()
+	defer fr.Unlock()
+	fr.view.Center = center
+	fr.view.Width = def.view.Width / zoom
+	fr.view.Height = fr.view.Width * aspect
+}
+
+// View returns the center and zoom of the view, as given to SetView.
+func (fr *Fractal) View() (center complex128, zoom float64) {
+	def, _ := NewFormula(fr.formula(), 0)
+	v := fr.Viewport()
+	return v.Center, def.view.Width / v.Width
+}
+
+// Buffer returns the samples of the latest render. It is complete once
+// IsFinished reports true.
+func (fr *Fractal) Buffer() *Buffer { return fr.buffer }
+
 func (fr *Fractal) Magnify(imageSize, magnifySize graphic.Box, magnifyPoint image.Point) {
 	fr.Lock()
 	defer fr.Unlock()
 
-	colScaler := fr.colScalerGenerator(imageSize.Width)
-	rowScaler := fr.rowScalerGenerator(imageSize.Height)
-	fr.xMin = colScaler(magnifyPoint.X - magnifySize.Width/2)
-	fr.yMin = rowScaler(magnifyPoint.Y - magnifySize.Height/2)
-	fr.xMax = colScaler(magnifyPoint.X + magnifySize.Width/2)
-	fr.yMax = rowScaler(magnifyPoint.Y + magnifySize.Height/2)
+	fr.view.Center = fr.view.Point(imageSize, float64(magnifyPoint.X), float64(magnifyPoint.Y))
+	fr.view.Width *= float64(magnifySize.Width) / float64(imageSize.Width)
+	fr.view.Height *= float64(magnifySize.Height) / float64(imageSize.Height)
 }
 
+// DeMagnify widens the view ratio times around its center.
 func (fr *Fractal) DeMagnify(ratio float64) {
 	fr.Lock()
 	defer fr.Unlock()
 
-	fr.xMin *= ratio
-	fr.yMin *= ratio
-	fr.xMax *= ratio
-	fr.yMax *= ratio
+	fr.view.Width *= ratio
+	fr.view.Height *= ratio
+}
+
+// ZoomAt magnifies the view factor times around the position x, y in an
+// image of imageSize, keeping the point there in place. Factors below 1
+// zoom out.
+func (fr *Fractal) ZoomAt(imageSize graphic.Box, x, y, factor float64) {
+	fr.Lock()
+	defer fr.Unlock()
+
+	fr.view = fr.view.Zoom(imageSize, x, y, factor)
 }
 
-func (fr *Fractal) Render(imageSize graphic.Box, maxIterations int, bailoutRadius float64, normalize bool, sampleRatio int, setColor color.RGBA, palette palette.Palette, colorFrequency float64) chan graphic.Pixel {
+// Render renders the view into an image of imageSize and sends the colored
+// pixels on the returned channel, which is closed when the render is done.
+func (fr *Fractal) Render(imageSize graphic.Box, settings Settings) (chan graphic.Pixel, error) {
+	if err := settings.check(); err != nil {
+		return nil, err
+	}
 	fr.Lock()
 	pixChan := make(chan graphic.Pixel, imageSize.Height)
 	fr.newRequest(imageSize.Height * imageSize.Width)
+	fr.buffer = newBuffer(imageSize, settings, fr.view.Width/float64(imageSize.Width))
+	rs := newRenderSettings(imageSize, settings)
+	fr.buffer.iteration = fr.iteration(rs)
 	go func() {
 		defer close(pixChan)
 		defer fr.Unlock()
 
-		rs := &renderSettings{imageSize, maxIterations, bailoutRadius, normalize, sampleRatio, setColor, palette, colorFrequency}		
+		// Layers that look at neighbouring pixels can only be colored once
+		// all samples are done.
+		stream := pixChan
+		if rs.needsNeighbours() {
+			stream = nil
+		}
 
-		if rs.sampleRatio > 1 {
-			fr.renderOverSampled(rs, pixChan)
-		} else {
-			fr.renderStandardSampled(rs, pixChan)
+		fr.renderArea(rs, stream, image.Rect(0, 0, imageSize.Width, imageSize.Height))
+		if stream == nil {
+			fr.buffer.stream(rs, pixChan)
 		}
 	}()
-	return pixChan
+	return pixChan, nil
+}
+
+// iteration describes how the samples of a render with rs are iterated.
+func (fr *Fractal) iteration(rs *renderSettings) iteration {
+	it := iteration{
+		isMandelbrot:  fr.isMandelbrot,
+		juliaConstant: fr.juliaConstant,
+		bailout:       rs.BailoutRadius,
+		trap:          rs.trap,
+		hasTrap:       rs.hasTrap,
+	}
+	it.colStep, it.rowStep = fr.view.steps(rs.Box)
+	return it
 }
 
-func (fr *Fractal) renderStandardSampled(rs *renderSettings, pixChan chan graphic.Pixel) {
-	colScaler := fr.colScalerGenerator(rs.Width)
-	rowScaler := fr.rowScalerGenerator(rs.Height)
+// renderArea renders the pixels of area into the buffer, and sends them
+// colored to pixChan unless it is nil.
+func (fr *Fractal) renderArea(rs *renderSettings, pixChan chan graphic.Pixel, area image.Rectangle) {
+	if rs.SampleRatio > 1 {
+		fr.renderOverSampled(rs, pixChan, area)
+	} else {
+		fr.renderStandardSampled(rs, pixChan, area)
+	}
+}
+
+func (fr *Fractal) renderStandardSampled(rs *renderSettings, pixChan chan graphic.Pixel, area image.Rectangle) {
+	colScaler := fr.colScalerGenerator(rs.Box)
+	rowScaler := fr.rowScalerGenerator(rs.Box)
 	wg := new(sync.WaitGroup)
-	for row := 0; row < rs.Height; row++ {
+	for row := area.Min.Y; row < area.Max.Y; row++ {
 		wg.Add(1)
 		go func(row int) {
-			for col := 0; col < rs.Width; col++ {
-				x, y := colScaler(col), rowScaler(row)
-				color := fr.renderPoint(complex(x, y), rs)
-				pixChan <- graphic.Pix(color, col, row)
+			for col := area.Min.X; col < area.Max.X; col++ {
+				fr.buffer.pixel(col, row)[0] = fr.iterate(colScaler(col)+rowScaler(row), rs)
+				if pixChan != nil {
+					pixChan <- graphic.Pix(rs.colorizePixel(fr.buffer, col, row), col, row)
+				}
 				fr.elementFinished()
 			}
 			wg.Done()
@@ -104,19 +210,19 @@ func (fr *Fractal) renderStandardSampled(rs *renderSettings, pixChan chan graphi
 	wg.Wait()
 }
 
-func (fr *Fractal) renderOverSampled(rs *renderSettings, pixChan chan graphic.Pixel) {
-	colScaler := fr.colScalerGenerator(rs.Width)
-	rowScaler := fr.rowScalerGenerator(rs.Height)
-	pixelWidth := (fr.xMax - fr.xMin) / float64(rs.Width)
-	pixelHeight := (fr.yMax - fr.yMin) / float64(rs.Height)
+func (fr *Fractal) renderOverSampled(rs *renderSettings, pixChan chan graphic.Pixel, area image.Rectangle) {
+	colScaler := fr.colScalerGenerator(rs.Box)
+	rowScaler := fr.rowScalerGenerator(rs.Box)
+	colStep, rowStep := fr.view.steps(rs.Box)
 	wg := new(sync.WaitGroup)
-	for row := 0; row < rs.Height; row++ {
+	for row := area.Min.Y; row < area.Max.Y; row++ {
 		wg.Add(1)
 		go func(row int) {
-			for col := 0; col < rs.Width; col++ {
-				x, y := colScaler(col), rowScaler(row)
-				color := fr.renderPixel(complex(x, y), pixelWidth, pixelHeight, rs)
-				pixChan <- graphic.Pix(color, col, row)
+			for col := area.Min.X; col < area.Max.X; col++ {
+				fr.samplePixel(colScaler(col)+rowScaler(row), colStep, rowStep, rs, fr.buffer.pixel(col, row))
+				if pixChan != nil {
+					pixChan <- graphic.Pix(rs.colorizePixel(fr.buffer, col, row), col, row)
+				}
 				fr.elementFinished()
 			}
 			wg.Done()
@@ -125,85 +231,136 @@ func (fr *Fractal) renderOverSampled(rs *renderSettings, pixChan chan graphic.Pi
 	wg.Wait()
 }
 
-func (fr *Fractal) renderPixel(point complex128, pixelWidth, pixelHeight float64, rs *renderSettings) color.RGBA {
-	colors := make([]color.RGBA, rs.sampleRatio*rs.sampleRatio)
-	for i := 0; i < rs.sampleRatio; i++ {
-		x := real(point) + pixelWidth*float64(i)/float64(rs.sampleRatio) - pixelWidth/2
-		for j := 0; j < rs.sampleRatio; j++ {
-			y := imag(point) + pixelHeight*float64(j)/float64(rs.sampleRatio) - pixelHeight/2
-			colors[i*rs.sampleRatio+j] = fr.renderPoint(complex(x, y), rs)
+// samplePixel iterates a grid of points spread over the pixel around point.
+// colStep and rowStep span the pixel.
+func (fr *Fractal) samplePixel(point, colStep, rowStep complex128, rs *renderSettings, samples []Sample) {
+	for i := 0; i < rs.SampleRatio; i++ {
+		x := colStep * complex(float64(i)/float64(rs.SampleRatio)-0.5, 0)
+		for j := 0; j < rs.SampleRatio; j++ {
+			y := rowStep * complex(float64(j)/float64(rs.SampleRatio)-0.5, 0)
+			samples[i*rs.SampleRatio+j] = fr.iterate(point+x+y, rs)
 		}
 	}
-
-	return palette.Mean(colors)
 }
 
-func (fr *Fractal) renderPoint(point complex128, rs *renderSettings) color.RGBA {
-	var z, c complex128
+// iterate runs the orbit of point until it escapes or the iteration limit
+// is reached. Along the way it tracks the derivative for the distance
+// estimate and, if a layer needs it, the closest approach to the orbit trap.
+func (fr *Fractal) iterate(point complex128, rs *renderSettings) Sample {
+	var z, c, dz complex128
 	if fr.isMandelbrot {
-		z, c = complex(0, 0), point
+		z, c, dz = complex(0, 0), point, complex(0, 0)
 	} else {
-		z, c = point, fr.juliaConstant
+		z, c, dz = point, fr.juliaConstant, complex(1, 0)
 	}
+	trap := math.Inf(1)
 	reSqr := real(z) * real(z)
 	imSqr := imag(z) * imag(z)
-	var n uint64
-	for n = 0; n < uint64(rs.maxIterations) && reSqr+imSqr < rs.bailoutRadius; n++ {
+	var n int
+	for n = 0; n < rs.MaxIterations && reSqr+imSqr < rs.BailoutRadius; n++ {
+		dz = 2 * z * dz
+		if fr.isMandelbrot {
+			dz++
+		}
 		z = complex(reSqr-imSqr, 2*real(z)*imag(z)) + c
 		reSqr = real(z) * real(z)
 		imSqr = imag(z) * imag(z)
-	}
-	if n == uint64(rs.maxIterations) {
-		return rs.setColor
+		if rs.hasTrap {
+			trap = math.Min(trap, cmplx.Abs(z-rs.trap))
+		}
 	}
 
-	if rs.normalize {
-		v := float64(n)
-		zAbs := math.Sqrt(reSqr + imSqr)
-		corr := math.Log10(math.Log10(zAbs)) / math.Log10(2.0)
-		v -= corr
-		v *= rs.colorFrequency
-		n = uint64(v)
-	} else {
-		n *= uint64(rs.colorFrequency)
+	var de float64
+	if zAbs := math.Sqrt(reSqr + imSqr); n < rs.MaxIterations {
+		de = zAbs * math.Log(zAbs) / cmplx.Abs(dz)
 	}
+	return Sample{int32(n), complex64(z), float32(de), float32(trap)}
+}
+
+// colScalerGenerator and rowScalerGenerator map the pixels of an image of
+// imageSize to the view: the point of a pixel is colScaler(col) +
+// rowScaler(row).
+func (fr *Fractal) colScalerGenerator(imageSize graphic.Box) func(col int) complex128 {
+	step, _ := fr.view.steps(imageSize)
+	offset := fr.view.Point(imageSize, 0, 0)
 
-	return rs.palette[n%uint64(len(rs.palette))]
+	return func(col int) complex128 {
+		return offset + step*complex(float64(col), 0)
+	}
 }
 
-func (fr *Fractal) colScalerGenerator(width int) func(col int) float64 {
-	xRange := fr.xMax - fr.xMin
-	xScale := xRange / float64(width)
-	xOffset := fr.xMin
+func (fr *Fractal) rowScalerGenerator(imageSize graphic.Box) func(row int) complex128 {
+	_, step := fr.view.steps(imageSize)
 
-	return func(col int) float64 {
-		x := float64(col)
-		x *= xScale
-		x += xOffset
-		return x
+	return func(row int) complex128 {
+		return step * complex(float64(row), 0)
 	}
 }
 
-func (fr *Fractal) rowScalerGenerator(height int) func(row int) float64 {
-	yRange := fr.yMax - fr.yMin
-	yScale := yRange / float64(height)
-	yOffset := fr.yMin
+// Settings holds the render parameters that are independent of the
+// location in the complex plane.
+type Settings struct {
+	MaxIterations  int
+	BailoutRadius  float64
+	Normalize      bool
+	SampleRatio    int
+	ColorFrequency float64
+	ColorOffset    float64 // palette rotation, in whole turns of the palette
+	Decomposition  Decomposition
+	Layers         []Layer // composited bottom to top
+}
 
-	return func(row int) float64 {
-		y := float64(row)
-		y *= yScale
-		y += yOffset
-		return y
+const minSampleRatio = -3
+
+// check reports settings that cannot be rendered. Sample ratios down to
+// minSampleRatio come from the downsampling choices of the explorer; they
+// render like 1.
+func (s Settings) check() error {
+	switch {
+	case s.MaxIterations < 1:
+		return fmt.Errorf("fractal: max iterations %d below 1", s.MaxIterations)
+	case s.SampleRatio < minSampleRatio:
+		return fmt.Errorf("fractal: sample ratio %d below %d", s.SampleRatio, minSampleRatio)
+	case !(s.BailoutRadius > 1):
+		return fmt.Errorf("fractal: bailout radius %g not above 1", s.BailoutRadius)
+	}
+	var trap *Layer
+	for i := range s.Layers {
+		l := &s.Layers[i]
+		if err := l.check(); err != nil {
+			return err
+		}
+		if l.Kind == OrbitTrapLayer {
+			// A render tracks the distance to a single trap point.
+			if trap != nil && l.Trap != trap.Trap {
+				return fmt.Errorf("fractal: orbit trap layers with different trap points")
+			}
+			trap = l
+		}
 	}
+	return nil
 }
 
 type renderSettings struct {
 	graphic.Box
-	maxIterations  int
-	bailoutRadius  float64
-	normalize      bool
-	sampleRatio    int
-	setColor       color.RGBA
-	palette        palette.Palette
-	colorFrequency float64
+	Settings
+	trap    complex128 // point of the first orbit trap layer
+	hasTrap bool
+}
+
+// newRenderSettings leaves out the layers that cannot be drawn, so that
+// recoloring a buffer with unchecked settings does not fail.
+func newRenderSettings(imageSize graphic.Box, settings Settings) *renderSettings {
+	rs := &renderSettings{Box: imageSize, Settings: settings}
+	rs.Layers = nil
+	for _, l := range settings.Layers {
+		if l.check() != nil {
+			continue
+		}
+		if l.Kind == OrbitTrapLayer && !rs.hasTrap {
+			rs.trap, rs.hasTrap = l.Trap, true
+		}
+		rs.Layers = append(rs.Layers, l)
+	}
+	return rs
 }
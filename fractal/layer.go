@@ -0,0 +1,269 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"saph/graphic/palette"
+)
+
+// LayerKind selects how a coloring layer derives its colors.
+type LayerKind int
+
+const (
+	// PaletteLayer colors by the escape-time palette and decomposition.
+	PaletteLayer LayerKind = iota
+	// GlowLayer is a color fading out with the distance estimate to the
+	// set, Width pixels wide.
+	GlowLayer
+	// SlopeLayer is the grey light of slope shading, see Lighting.
+	SlopeLayer
+	// OrbitTrapLayer colors by how close the orbit came to Trap, fading
+	// out at a distance of Width. A render tracks a single trap: Render
+	// refuses orbit trap layers with different Trap points.
+	OrbitTrapLayer
+)
+
+// BlendMode selects how a layer is combined with the layers below it.
+type BlendMode int
+
+const (
+	Normal BlendMode = iota
+	Multiply
+	Screen
+	Overlay
+	SoftLight
+)
+
+// Mask limits a layer to a part of the image.
+type Mask int
+
+const (
+	NoMask      Mask = iota
+	OutsideMask      // only where points escape
+	InsideMask       // only inside the set
+)
+
+var (
+	layerKindNames = []string{"Palette", "Glow", "Slope", "Orbit trap"}
+	blendModeNames = []string{"Normal", "Multiply", "Screen", "Overlay", "Soft light"}
+	maskNames      = []string{"None", "Outside", "Inside"}
+)
+
+func (k LayerKind) String() string { return enumName(layerKindNames, int(k), "LayerKind") }
+func (m BlendMode) String() string { return enumName(blendModeNames, int(m), "BlendMode") }
+func (m Mask) String() string      { return enumName(maskNames, int(m), "Mask") }
+
+func enumName(names []string, i int, typeName string) string {
+	if i < 0 || i >= len(names) {
+		return fmt.Sprintf("%s(%d)", typeName, i)
+	}
+	return names[i]
+}
+
+// Layer is one coloring of a render. The layers of Settings are
+// composited bottom to top, each weighted by its opacity and mask.
+type Layer struct {
+	Kind     LayerKind
+	Opacity  float64 // 0 <= Opacity <= 1
+	Blend    BlendMode
+	Mask     Mask
+	Palette  palette.Palette // palette and orbit trap layers
+	SetColor color.RGBA      // color inside the set of palette layers
+	Color    color.RGBA      // glow color
+	Width    float64         // glow width in pixels, orbit trap radius
+	Trap     complex128      // orbit trap point, the same for all orbit trap layers of a render
+	Lighting Lighting        // slope layers
+}
+
+func NewPaletteLayer(p palette.Palette, setColor color.RGBA) Layer {
+	return Layer{Kind: PaletteLayer, Opacity: 1, Palette: p, SetColor: setColor}
+}
+
+func NewGlowLayer(c color.RGBA, width float64) Layer {
+	return Layer{Kind: GlowLayer, Opacity: 1, Blend: Screen, Mask: OutsideMask, Color: c, Width: width}
+}
+
+func NewSlopeLayer(light Lighting) Layer {
+	return Layer{Kind: SlopeLayer, Opacity: 1, Blend: Multiply, Mask: OutsideMask, Lighting: light}
+}
+
+func NewOrbitTrapLayer(p palette.Palette, trap complex128, width float64) Layer {
+	return Layer{Kind: OrbitTrapLayer, Opacity: 1, Palette: p, Trap: trap, Width: width}
+}
+
+// check reports layers that cannot be drawn.
+func (l *Layer) check() error {
+	if l.Opacity < 0 || l.Opacity > 1 {
+		return fmt.Errorf("fractal: %v layer opacity %g outside [0, 1]", l.Kind, l.Opacity)
+	}
+	if (l.Kind == PaletteLayer || l.Kind == OrbitTrapLayer) && len(l.Palette) == 0 {
+		return fmt.Errorf("fractal: %v layer without palette", l.Kind)
+	}
+	if (l.Kind == GlowLayer || l.Kind == OrbitTrapLayer) && !(l.Width > 0) {
+		return fmt.Errorf("fractal: %v layer width %g not positive", l.Kind, l.Width)
+	}
+	return nil
+}
+
+// rgb is a color with channels in [0, 1].
+type rgb [3]float64
+
+func toRGB(c color.RGBA) rgb {
+	return rgb{float64(c.R) / 255, float64(c.G) / 255, float64(c.B) / 255}
+}
+
+func (c rgb) RGBA() color.RGBA {
+	return color.RGBA{channelByte(c[0]), channelByte(c[1]), channelByte(c[2]), 0xFF}
+}
+
+func (c rgb) RGBA64() color.RGBA64 {
+	return color.RGBA64{channelWord(c[0]), channelWord(c[1]), channelWord(c[2]), 0xFFFF}
+}
+
+func (c rgb) scale(f float64) rgb {
+	return rgb{c[0] * f, c[1] * f, c[2] * f}
+}
+
+func channelByte(x float64) uint8 {
+	return uint8(math.Max(0, math.Min(1, x))*255 + 0.5)
+}
+
+func channelWord(x float64) uint16 {
+	return uint16(math.Max(0, math.Min(1, x))*0xFFFF + 0.5)
+}
+
+// colorizePixel composites the layers at the pixel x, y of the buffer.
+func (rs *renderSettings) colorizePixel(b *Buffer, x, y int) color.RGBA {
+	return rs.compose(b, x, y).RGBA()
+}
+
+func (rs *renderSettings) compose(b *Buffer, x, y int) rgb {
+	samples := b.pixel(x, y)
+	escaped := 0
+	for _, s := range samples {
+		if int(s.N) != b.MaxIterations {
+			escaped++
+		}
+	}
+	outside := float64(escaped) / float64(len(samples))
+
+	var result rgb
+	for i := range rs.Layers {
+		l := &rs.Layers[i]
+		c, alpha := rs.layerColor(l, b, x, y, samples)
+		switch l.Mask {
+		case OutsideMask:
+			alpha *= outside
+		case InsideMask:
+			alpha *= 1 - outside
+		}
+		alpha *= l.Opacity
+		if alpha <= 0 {
+			continue
+		}
+		blended := l.Blend.apply(result, c)
+		for k := range result {
+			result[k] += (blended[k] - result[k]) * alpha
+		}
+	}
+	return result
+}
+
+// layerColor is the color and coverage of a layer at a pixel.
+func (rs *renderSettings) layerColor(l *Layer, b *Buffer, x, y int, samples []Sample) (rgb, float64) {
+	var sum rgb
+	var alpha float64
+	n := float64(len(samples))
+	switch l.Kind {
+	case PaletteLayer:
+		for _, s := range samples {
+			c := rs.colorize(s, l)
+			for k := range sum {
+				sum[k] += c[k] / n
+			}
+		}
+		return sum, 1
+
+	case GlowLayer:
+		for _, s := range samples {
+			if int(s.N) == b.MaxIterations {
+				continue
+			}
+			alpha += math.Exp(-float64(s.DE)/(b.PixelSize*l.Width)) / n
+		}
+		return toRGB(l.Color), alpha
+
+	case SlopeLayer:
+		if b.inside(x, y) {
+			return sum, 0
+		}
+		diffuse, specular := b.light(x, y, l.Lighting)
+		v := l.Lighting.Ambient + (1-l.Lighting.Ambient)*diffuse + specular
+		return rgb{v, v, v}, 1
+
+	case OrbitTrapLayer:
+		for _, s := range samples {
+			f := math.Min(1, float64(s.Trap)/l.Width)
+			c := paletteAt(l.Palette, f*float64(len(l.Palette)-1))
+			for k := range sum {
+				sum[k] += c[k] * (1 - f)
+			}
+			alpha += (1 - f) / n
+		}
+		if alpha > 0 {
+			for k := range sum {
+				sum[k] /= alpha * n
+			}
+		}
+		return sum, alpha
+	}
+	return sum, 0
+}
+
+// apply blends the color c of a layer onto the base color.
+func (m BlendMode) apply(base, c rgb) rgb {
+	var r rgb
+	for k := range r {
+		a, b := base[k], c[k]
+		switch m {
+		case Multiply:
+			r[k] = a * b
+		case Screen:
+			r[k] = 1 - (1-a)*(1-b)
+		case Overlay:
+			if a < 0.5 {
+				r[k] = 2 * a * b
+			} else {
+				r[k] = 1 - 2*(1-a)*(1-b)
+			}
+		case SoftLight:
+			if b <= 0.5 {
+				r[k] = a - (1-2*b)*a*(1-a)
+			} else {
+				d := math.Sqrt(a)
+				if a <= 0.25 {
+					d = ((16*a-12)*a + 4) * a
+				}
+				r[k] = a + (2*b-1)*(d-a)
+			}
+		default:
+			r[k] = b
+		}
+	}
+	return r
+}
+
+// needsNeighbours reports whether any layer depends on the pixels around
+// a pixel, so that the image can only be colored once all samples are done.
+func (rs *renderSettings) needsNeighbours() bool {
+	for _, l := range rs.Layers {
+		if l.Kind == SlopeLayer {
+			return true
+		}
+	}
+	return false
+}
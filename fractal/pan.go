@@ -0,0 +1,113 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"image"
+	"saph/graphic"
+)
+
+// Pan moves the view dx, dy pixels of an image of imageSize, so that the
+// pixel at x, y of the latest render moves to x+dx, y+dy. Only the pixels
+// that come into view are rendered; the samples of the others are moved in
+// the buffer. Like Render it sends the colored pixels that changed, all of
+// them when a layer looks at neighbouring pixels.
+//
+// If the latest render was iterated differently, with other settings,
+// fractal or view size, or is out of view, the whole image is rendered.
+func (fr *Fractal) Pan(imageSize graphic.Box, dx, dy int, settings Settings) (chan graphic.Pixel, error) {
+	if err := settings.check(); err != nil {
+		return nil, err
+	}
+	fr.Lock()
+	fr.view.Center = fr.view.Point(imageSize, float64(imageSize.Width)/2-float64(dx), float64(imageSize.Height)/2-float64(dy))
+	b := fr.buffer
+	rs := newRenderSettings(imageSize, settings)
+	ratio := settings.SampleRatio
+	if ratio < 1 {
+		ratio = 1
+	}
+	if b == nil || b.Box != imageSize || b.SampleRatio != ratio || b.MaxIterations != settings.MaxIterations ||
+		b.iteration != fr.iteration(rs) || abs(dx) >= imageSize.Width || abs(dy) >= imageSize.Height {
+		fr.Unlock()
+		return fr.Render(imageSize, settings)
+	}
+
+	exposed := exposedAreas(imageSize, dx, dy)
+	var n int
+	for _, r := range exposed {
+		n += r.Dx() * r.Dy()
+	}
+	total := imageSize.Width * imageSize.Height
+	fr.resume(total, total-n)
+	fr.buffer = b.shifted(dx, dy)
+	pixChan := make(chan graphic.Pixel, imageSize.Height)
+	go func() {
+		defer close(pixChan)
+		defer fr.Unlock()
+
+		stream := pixChan
+		if rs.needsNeighbours() {
+			stream = nil
+		}
+		for _, r := range exposed {
+			fr.renderArea(rs, stream, r)
+		}
+		if stream == nil {
+			fr.buffer.stream(rs, pixChan)
+		}
+	}()
+	return pixChan, nil
+}
+
+// exposedAreas returns the pixels of an image of size that come into view
+// when it moves dx, dy pixels: a column strip and a row strip.
+func exposedAreas(size graphic.Box, dx, dy int) []image.Rectangle {
+	var areas []image.Rectangle
+	cols := image.Rect(0, 0, size.Width, size.Height)
+	switch {
+	case dx > 0:
+		areas = append(areas, image.Rect(0, 0, dx, size.Height))
+		cols.Min.X = dx
+	case dx < 0:
+		areas = append(areas, image.Rect(size.Width+dx, 0, size.Width, size.Height))
+		cols.Max.X = size.Width + dx
+	}
+	switch {
+	case dy > 0:
+		areas = append(areas, image.Rect(cols.Min.X, 0, cols.Max.X, dy))
+	case dy < 0:
+		areas = append(areas, image.Rect(cols.Min.X, size.Height+dy, cols.Max.X, size.Height))
+	}
+	return areas
+}
+
+// shifted returns a copy of the buffer with the samples moved dx, dy
+// pixels. The pixels moved in from outside are left zero.
+func (b *Buffer) shifted(dx, dy int) *Buffer {
+	s := *b
+	s.Samples = make([]Sample, len(b.Samples))
+	n := b.SampleRatio * b.SampleRatio
+	x0, x1 := 0, b.Width
+	if dx > 0 {
+		x0 = dx
+	} else {
+		x1 += dx
+	}
+	for y := 0; y < b.Height; y++ {
+		from := y - dy
+		if from < 0 || from >= b.Height {
+			continue
+		}
+		copy(s.Samples[(y*b.Width+x0)*n:(y*b.Width+x1)*n], b.Samples[(from*b.Width+x0-dx)*n:])
+	}
+	return &s
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
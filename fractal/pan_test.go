@@ -0,0 +1,153 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"image"
+	"math/cmplx"
+	"saph/graphic"
+	"saph/graphic/palette"
+	"testing"
+)
+
+func TestExposedAreas(t *testing.T) {
+	size := graphic.Box{Width: 10, Height: 8}
+	for _, c := range []struct {
+		dx, dy int
+		want   []image.Rectangle
+	}{
+		{0, 0, nil},
+		{3, 0, []image.Rectangle{image.Rect(0, 0, 3, 8)}},
+		{-3, 0, []image.Rectangle{image.Rect(7, 0, 10, 8)}},
+		{0, 2, []image.Rectangle{image.Rect(0, 0, 10, 2)}},
+		{0, -2, []image.Rectangle{image.Rect(0, 6, 10, 8)}},
+		{3, -2, []image.Rectangle{image.Rect(0, 0, 3, 8), image.Rect(3, 6, 10, 8)}},
+		{-3, 2, []image.Rectangle{image.Rect(7, 0, 10, 8), image.Rect(0, 0, 7, 2)}},
+	} {
+		got := exposedAreas(size, c.dx, c.dy)
+		if len(got) != len(c.want) {
+			t.Errorf("%d, %d: %v, want %v", c.dx, c.dy, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%d, %d: %v, want %v", c.dx, c.dy, got, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestBufferShifted(t *testing.T) {
+	b := &Buffer{Box: graphic.Box{Width: 5, Height: 4}, SampleRatio: 2}
+	b.Samples = make([]Sample, 5*4*4)
+	for i := range b.Samples {
+		b.Samples[i].N = int32(i + 1)
+	}
+	for _, d := range []image.Point{{2, 1}, {-1, 3}, {0, -2}, {-4, -3}} {
+		s := b.shifted(d.X, d.Y)
+		// The pixels the old image moved to.
+		moved := image.Rect(d.X, d.Y, b.Width+d.X, b.Height+d.Y)
+		for y := 0; y < b.Height; y++ {
+			for x := 0; x < b.Width; x++ {
+				got := s.pixel(x, y)
+				for i := range got {
+					want := int32(0)
+					if image.Pt(x, y).In(moved) {
+						want = b.pixel(x-d.X, y-d.Y)[i].N
+					}
+					if got[i].N != want {
+						t.Fatalf("shifted %v: sample %d of %d, %d is %d, want %d", d, i, x, y, got[i].N, want)
+					}
+				}
+			}
+		}
+	}
+	if b.Samples[0].N != 1 {
+		t.Error("shifted changed the buffer")
+	}
+}
+
+func panSettings() Settings {
+	return Settings{
+		MaxIterations: 100,
+		BailoutRadius: 4,
+		SampleRatio:   2,
+		Layers:        []Layer{NewPaletteLayer(palette.Palette{palette.Black, palette.White}, palette.Black)},
+	}
+}
+
+// count counts the pixels sent by a render, or is -1 if it failed.
+func count(pixChan chan graphic.Pixel, err error) int {
+	if err != nil {
+		return -1
+	}
+	var n int
+	for range pixChan {
+		n++
+	}
+	return n
+}
+
+func TestPan(t *testing.T) {
+	size := graphic.Box{Width: 40, Height: 30}
+	settings := panSettings()
+	fr := testFractal()
+	count(fr.Render(size, settings))
+
+	if n := count(fr.Pan(size, 7, -4, settings)); n != 7*30+33*4 {
+		t.Errorf("Pan sent %d pixels, want %d", n, 7*30+33*4)
+	}
+	panned := fr.Buffer()
+
+	fresh := testFractal()
+	fresh.SetViewport(fr.Viewport())
+	count(fresh.Render(size, settings))
+	// The pixels may be a rounding error off those of the fresh render.
+	for i, s := range fresh.Buffer().Samples {
+		if p := panned.Samples[i]; p.N != s.N || cmplx.Abs(complex128(p.Z-s.Z)) > 1e-5*cmplx.Abs(complex128(s.Z)) {
+			t.Fatalf("sample %d of the panned image is %+v, want %+v", i, p, s)
+		}
+	}
+}
+
+// Pan renders everything when the latest render was iterated differently.
+func TestPanRendersAgain(t *testing.T) {
+	size := graphic.Box{Width: 40, Height: 30}
+	total := size.Width * size.Height
+	for _, c := range []struct {
+		name   string
+		change func(fr *Fractal, s *Settings)
+	}{
+		{"iterations", func(fr *Fractal, s *Settings) { s.MaxIterations++ }},
+		{"samples", func(fr *Fractal, s *Settings) { s.SampleRatio = 1 }},
+		{"bailout", func(fr *Fractal, s *Settings) { s.BailoutRadius = 8 }},
+		{"orbit trap", func(fr *Fractal, s *Settings) {
+			s.Layers = append(s.Layers, NewOrbitTrapLayer(palette.Palette{palette.White}, 0.5, 0.5))
+		}},
+		{"Julia constant", func(fr *Fractal, s *Settings) { fr.juliaConstant = complex(0.3, 0.5) }},
+		{"formula", func(fr *Fractal, s *Settings) { fr.isMandelbrot = true }},
+		{"zoom", func(fr *Fractal, s *Settings) { fr.DeMagnify(2) }},
+		{"rotation", func(fr *Fractal, s *Settings) {
+			v := fr.Viewport()
+			v.Rotation += 0.1
+			fr.SetViewport(v)
+		}},
+	} {
+		fr, settings := testFractal(), panSettings()
+		count(fr.Render(size, settings))
+		c.change(fr, &settings)
+		if n := count(fr.Pan(size, 3, 2, settings)); n != total {
+			t.Errorf("%s changed: Pan sent %d pixels, want all %d", c.name, n, total)
+		}
+	}
+
+	// A trap point the render already used needs no new render.
+	fr, settings := testFractal(), panSettings()
+	settings.Layers = append(settings.Layers, NewOrbitTrapLayer(palette.Palette{palette.White}, 0.5, 0.5))
+	count(fr.Render(size, settings))
+	if n := count(fr.Pan(size, 3, 0, settings)); n != 3*30 {
+		t.Errorf("unchanged orbit trap: Pan sent %d pixels, want %d", n, 3*30)
+	}
+}
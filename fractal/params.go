@@ -0,0 +1,275 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"saph/graphic/palette"
+)
+
+// ParamsVersion is the version of the parameter file format written by
+// SaveParams. LoadParams reads this and all earlier versions.
+const ParamsVersion = 1
+
+// params is the parameter file: a JSON document describing a fractal and
+// the settings it is rendered with.
+//
+//	{
+//		"Version": 1,
+//		"Formula": "Mandelbrot",
+//		"Bounds": [-2.5, -1.5, 1, 1.5],
+//		"Settings": {"MaxIterations": 300, ...}
+//	}
+//
+// Instead of Bounds a file may give Center and Zoom, the magnification
+// relative to the default view of the formula. Rotation turns the view
+// counterclockwise, in radians. JuliaConstant is only used by the Julia
+// formula.
+type params struct {
+	Version       int
+	Formula       string
+	JuliaConstant []float64 `json:",omitempty"`
+	Bounds        []float64 `json:",omitempty"`
+	Center        []float64 `json:",omitempty"`
+	Zoom          float64   `json:",omitempty"`
+	Rotation      float64   `json:",omitempty"`
+	Settings      settingsParams
+}
+
+// settingsParams is the stored form of Settings.
+type settingsParams struct {
+	MaxIterations  int
+	BailoutRadius  float64
+	Normalize      bool
+	SampleRatio    int
+	ColorFrequency float64
+	ColorOffset    float64
+	Decomposition  []string
+	Layers         []layerParams
+}
+
+var decompositionNames = []string{"Binary", "Angle", "Field lines"}
+
+// SaveParams writes the fractal and settings as a parameter file.
+func (fr *Fractal) SaveParams(w io.Writer, settings Settings) error {
+	v := fr.Viewport()
+	b := v.Bounds()
+	p := params{
+		Version:  ParamsVersion,
+		Formula:  fr.formula(),
+		Bounds:   []float64{b.XMin, b.YMin, b.XMax, b.YMax},
+		Rotation: v.Rotation,
+		Settings: newSettingsParams(settings),
+	}
+	if !fr.IsMandelbrot() {
+		c := fr.JuliaConstant()
+		p.JuliaConstant = []float64{real(c), imag(c)}
+	}
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// LoadParams reads a parameter file written by SaveParams.
+func LoadParams(r io.Reader) (*Fractal, Settings, error) {
+	var p params
+	if err := json.NewDecoder(r).Decode(&p); err != nil {
+		return nil, Settings{}, err
+	}
+	if p.Version < 1 || p.Version > ParamsVersion {
+		return nil, Settings{}, fmt.Errorf("fractal: unsupported parameter file version %d", p.Version)
+	}
+
+	var c complex128
+	if len(p.JuliaConstant) == 2 {
+		c = complex(p.JuliaConstant[0], p.JuliaConstant[1])
+	}
+	fr, err := NewFormula(p.Formula, c)
+	if err != nil {
+		return nil, Settings{}, err
+	}
+	switch {
+	case len(p.Bounds) == 4:
+		fr.SetBounds(Bounds{p.Bounds[0], p.Bounds[1], p.Bounds[2], p.Bounds[3]})
+	case len(p.Center) == 2 && p.Zoom > 0:
+		b := fr.Bounds()
+		fr.SetView(complex(p.Center[0], p.Center[1]), p.Zoom, (b.YMax-b.YMin)/(b.XMax-b.XMin))
+	default:
+		return nil, Settings{}, fmt.Errorf("fractal: parameter file needs Bounds or Center and Zoom")
+	}
+	v := fr.Viewport()
+	v.Rotation = p.Rotation
+	fr.SetViewport(v)
+
+	settings, err := p.Settings.settings()
+	if err != nil {
+		return nil, Settings{}, err
+	}
+	return fr, settings, nil
+}
+
+// formula names the iterated function, as used by NewFormula.
+func (fr *Fractal) formula() string {
+	if fr.isMandelbrot {
+		return "Mandelbrot"
+	}
+	return "Julia"
+}
+
+func newSettingsParams(s Settings) settingsParams {
+	p := settingsParams{
+		MaxIterations:  s.MaxIterations,
+		BailoutRadius:  s.BailoutRadius,
+		Normalize:      s.Normalize,
+		SampleRatio:    s.SampleRatio,
+		ColorFrequency: s.ColorFrequency,
+		ColorOffset:    s.ColorOffset,
+		Decomposition:  []string{},
+		Layers:         newLayersParams(s.Layers),
+	}
+	for i, name := range decompositionNames {
+		if s.Decomposition&(1<<uint(i)) != 0 {
+			p.Decomposition = append(p.Decomposition, name)
+		}
+	}
+	return p
+}
+
+func (p settingsParams) settings() (Settings, error) {
+	s := Settings{
+		MaxIterations:  p.MaxIterations,
+		BailoutRadius:  p.BailoutRadius,
+		Normalize:      p.Normalize,
+		SampleRatio:    p.SampleRatio,
+		ColorFrequency: p.ColorFrequency,
+		ColorOffset:    p.ColorOffset,
+	}
+	for _, name := range p.Decomposition {
+		i, err := parseEnum(decompositionNames, name)
+		if err != nil {
+			return s, err
+		}
+		s.Decomposition |= 1 << uint(i)
+	}
+	var err error
+	if s.Layers, err = layers(p.Layers); err != nil {
+		return s, err
+	}
+	return s, s.check()
+}
+
+func newLayersParams(layers []Layer) []layerParams {
+	p := make([]layerParams, len(layers))
+	for i, l := range layers {
+		p[i] = newLayerParams(l)
+	}
+	return p
+}
+
+func layers(params []layerParams) ([]Layer, error) {
+	var layers []Layer
+	for _, p := range params {
+		l, err := p.layer()
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, l)
+	}
+	return layers, nil
+}
+
+// layerParams is the stored form of a Layer, with enumerations by name
+// and colors in hexadecimal.
+type layerParams struct {
+	Kind     string
+	Opacity  float64
+	Blend    string
+	Mask     string
+	Palette  palette.Palette `json:",omitempty"`
+	SetColor string          `json:",omitempty"`
+	Color    string          `json:",omitempty"`
+	Width    float64         `json:",omitempty"`
+	Trap     []float64       `json:",omitempty"`
+	Lighting *Lighting       `json:",omitempty"`
+}
+
+func newLayerParams(l Layer) layerParams {
+	p := layerParams{
+		Kind:    l.Kind.String(),
+		Opacity: l.Opacity,
+		Blend:   l.Blend.String(),
+		Mask:    l.Mask.String(),
+	}
+	switch l.Kind {
+	case PaletteLayer:
+		p.Palette = l.Palette
+		p.SetColor = palette.Hex(l.SetColor)
+	case GlowLayer:
+		p.Color = palette.Hex(l.Color)
+		p.Width = l.Width
+	case SlopeLayer:
+		light := l.Lighting
+		p.Lighting = &light
+	case OrbitTrapLayer:
+		p.Palette = l.Palette
+		p.Width = l.Width
+		p.Trap = []float64{real(l.Trap), imag(l.Trap)}
+	}
+	return p
+}
+
+func (p layerParams) layer() (Layer, error) {
+	var l Layer
+	kind, err := parseEnum(layerKindNames, p.Kind)
+	if err != nil {
+		return l, err
+	}
+	blend, err := parseEnum(blendModeNames, p.Blend)
+	if err != nil {
+		return l, err
+	}
+	mask, err := parseEnum(maskNames, p.Mask)
+	if err != nil {
+		return l, err
+	}
+	l = Layer{
+		Kind:    LayerKind(kind),
+		Opacity: p.Opacity,
+		Blend:   BlendMode(blend),
+		Mask:    Mask(mask),
+		Palette: p.Palette,
+		Width:   p.Width,
+	}
+	if p.SetColor != "" {
+		if l.SetColor, err = palette.ParseHex(p.SetColor); err != nil {
+			return l, err
+		}
+	}
+	if p.Color != "" {
+		if l.Color, err = palette.ParseHex(p.Color); err != nil {
+			return l, err
+		}
+	}
+	if len(p.Trap) == 2 {
+		l.Trap = complex(p.Trap[0], p.Trap[1])
+	}
+	if p.Lighting != nil {
+		l.Lighting = *p.Lighting
+	}
+	return l, nil
+}
+
+func parseEnum(names []string, name string) (int, error) {
+	for i, n := range names {
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("fractal: unknown name %q", name)
+}
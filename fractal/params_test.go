@@ -0,0 +1,132 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"reflect"
+	"saph/graphic/palette"
+	"strings"
+	"testing"
+)
+
+func testSettings() Settings {
+	p := palette.Palette{palette.Black, palette.White}
+	return Settings{
+		MaxIterations:  250,
+		BailoutRadius:  20,
+		Normalize:      true,
+		SampleRatio:    -2,
+		ColorFrequency: 3,
+		ColorOffset:    0.25,
+		Decomposition:  BinaryDecomposition | FieldLines,
+		Layers: []Layer{
+			NewPaletteLayer(p, palette.Black),
+			NewOrbitTrapLayer(p, complex(0.5, -0.25), 0.5),
+			NewSlopeLayer(DefaultLighting),
+		},
+	}
+}
+
+func testFractal() *Fractal {
+	fr := NewJulia(complex(-0.8, 0.156))
+	fr.SetViewport(Viewport{Center: complex(0.1, -0.2), Width: 0.5, Height: 0.3, Rotation: 0.4})
+	return fr
+}
+
+func TestParamsRoundTrip(t *testing.T) {
+	fr, settings := testFractal(), testSettings()
+	var buf bytes.Buffer
+	if err := fr.SaveParams(&buf, settings); err != nil {
+		t.Fatal(err)
+	}
+	loaded, s, err := LoadParams(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.IsMandelbrot() || loaded.JuliaConstant() != fr.JuliaConstant() {
+		t.Errorf("formula: got Julia %v, want %v", loaded.JuliaConstant(), fr.JuliaConstant())
+	}
+	if got, want := loaded.Viewport(), fr.Viewport(); !sameViewport(got, want) {
+		t.Errorf("viewport: got %+v, want %+v", got, want)
+	}
+	if !reflect.DeepEqual(s, settings) {
+		t.Errorf("settings: got %+v, want %+v", s, settings)
+	}
+}
+
+func TestPNGRoundTrip(t *testing.T) {
+	fr, settings := testFractal(), testSettings()
+	var buf bytes.Buffer
+	if err := fr.EncodePNG(&buf, image.NewRGBA(image.Rect(0, 0, 4, 3)), settings); err != nil {
+		t.Fatal(err)
+	}
+	loaded, s, img, err := DecodePNG(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 4, 3) {
+		t.Errorf("image bounds: got %v", img.Bounds())
+	}
+	if got, want := loaded.Viewport(), fr.Viewport(); !sameViewport(got, want) {
+		t.Errorf("viewport: got %+v, want %+v", got, want)
+	}
+	if !reflect.DeepEqual(s, settings) {
+		t.Errorf("settings: got %+v, want %+v", s, settings)
+	}
+}
+
+func TestLoadParamsErrors(t *testing.T) {
+	for _, doc := range []string{
+		`{"Version": 2, "Formula": "Mandelbrot", "Bounds": [-2, -1, 1, 1], "Settings": {"MaxIterations": 10, "BailoutRadius": 4, "SampleRatio": 1}}`,
+		`{"Version": 1, "Formula": "Newton", "Bounds": [-2, -1, 1, 1], "Settings": {"MaxIterations": 10, "BailoutRadius": 4, "SampleRatio": 1}}`,
+		`{"Version": 1, "Formula": "Mandelbrot", "Settings": {"MaxIterations": 10, "BailoutRadius": 4, "SampleRatio": 1}}`,
+		`{"Version": 1, "Formula": "Mandelbrot", "Bounds": [-2, -1, 1, 1], "Settings": {"MaxIterations": 10, "BailoutRadius": 4, "SampleRatio": -4}}`,
+	} {
+		if _, _, err := LoadParams(strings.NewReader(doc)); err == nil {
+			t.Errorf("LoadParams(%s) succeeded", doc)
+		}
+	}
+}
+
+func TestDecodePNGErrors(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for _, c := range []struct {
+		name   string
+		change func(s *Settings)
+	}{
+		{"iterations", func(s *Settings) { s.MaxIterations = 0 }},
+		{"sample ratio", func(s *Settings) { s.SampleRatio = -4 }},
+		{"bailout", func(s *Settings) { s.BailoutRadius = 1 }},
+		{"trap width", func(s *Settings) { s.Layers[1].Width = 0 }},
+	} {
+		s := testSettings()
+		s.Layers = append([]Layer(nil), s.Layers...)
+		c.change(&s)
+		var buf bytes.Buffer
+		if err := testFractal().EncodePNG(&buf, img, s); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err := DecodePNG(&buf); err == nil {
+			t.Errorf("%s: DecodePNG succeeded", c.name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := DecodePNG(&buf); err == nil {
+		t.Error("DecodePNG of a PNG without parameters succeeded")
+	}
+}
+
+// sameViewport compares views, allowing for rounding through bounds.
+func sameViewport(a, b Viewport) bool {
+	near := func(x, y float64) bool { return x-y < 1e-12 && y-x < 1e-12 }
+	return near(real(a.Center), real(b.Center)) && near(imag(a.Center), imag(b.Center)) &&
+		near(a.Width, b.Width) && near(a.Height, b.Height) && a.Rotation == b.Rotation
+}
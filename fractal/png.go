@@ -0,0 +1,200 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"saph/graphic/pngchunk"
+	"strconv"
+	"strings"
+)
+
+// Keywords of the text chunks written by EncodePNG.
+const (
+	keySoftware       = "Software"
+	keyType           = "Fractal type"
+	keyJuliaConstant  = "Julia constant"
+	keyBounds         = "Bounds"
+	keyRotation       = "Rotation"
+	keyMaxIterations  = "Max iterations"
+	keyBailoutRadius  = "Bailout radius"
+	keyNormalize      = "Normalize"
+	keySampleRatio    = "Sample ratio"
+	keyColorFrequency = "Color frequency"
+	keyColorOffset    = "Color offset"
+	keyDecomposition  = "Decomposition"
+	keyLayers         = "Layers"
+)
+
+const software = "Fractal Explorer"
+
+// EncodePNG writes img as a PNG with the fractal and the settings it was
+// rendered with stored in text chunks, so that DecodePNG can restore them.
+func (fr *Fractal) EncodePNG(w io.Writer, img image.Image, settings Settings) error {
+	text, err := fr.textChunks(settings)
+	if err != nil {
+		return err
+	}
+	return png.Encode(pngchunk.NewInserter(w, text...), img)
+}
+
+func (fr *Fractal) textChunks(settings Settings) ([]pngchunk.Chunk, error) {
+	layersJSON, err := json.Marshal(newLayersParams(settings.Layers))
+	if err != nil {
+		return nil, err
+	}
+
+	v := fr.Viewport()
+	b := v.Bounds()
+	chunks := []pngchunk.Chunk{
+		pngchunk.Text(keySoftware, software),
+		pngchunk.Text(keyType, fr.formula()),
+		pngchunk.Text(keyJuliaConstant, strconv.FormatComplex(fr.JuliaConstant(), 'g', -1, 128)),
+		pngchunk.Text(keyBounds, formatFloats(b.XMin, b.YMin, b.XMax, b.YMax)),
+		pngchunk.Text(keyRotation, formatFloats(v.Rotation)),
+		pngchunk.Text(keyMaxIterations, strconv.Itoa(settings.MaxIterations)),
+		pngchunk.Text(keyBailoutRadius, formatFloats(settings.BailoutRadius)),
+		pngchunk.Text(keyNormalize, strconv.FormatBool(settings.Normalize)),
+		pngchunk.Text(keySampleRatio, strconv.Itoa(settings.SampleRatio)),
+		pngchunk.Text(keyColorFrequency, formatFloats(settings.ColorFrequency)),
+		pngchunk.Text(keyColorOffset, formatFloats(settings.ColorOffset)),
+		pngchunk.Text(keyDecomposition, strconv.FormatUint(uint64(settings.Decomposition), 10)),
+		pngchunk.InternationalText(keyLayers, string(layersJSON)),
+	}
+	return chunks, nil
+}
+
+// DecodePNG reads a PNG written by EncodePNG and restores the fractal and
+// the settings stored in it.
+func DecodePNG(r io.Reader) (*Fractal, Settings, image.Image, error) {
+	var settings Settings
+	var buf bytes.Buffer
+	chunks, err := pngchunk.Read(io.TeeReader(r, &buf))
+	if err != nil {
+		return nil, settings, nil, err
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		return nil, settings, nil, err
+	}
+
+	text := make(map[string]string)
+	for _, c := range chunks {
+		if !c.IsText() {
+			continue
+		}
+		keyword, value, err := pngchunk.ParseText(c)
+		if err != nil {
+			return nil, settings, nil, err
+		}
+		text[keyword] = value
+	}
+	if text[keySoftware] != software {
+		return nil, settings, nil, fmt.Errorf("fractal: PNG has no fractal parameters")
+	}
+
+	p := &textParser{text: text}
+	fr, err := NewFormula(text[keyType], p.complex(keyJuliaConstant))
+	if err != nil {
+		return nil, settings, nil, err
+	}
+	bounds := p.floats(keyBounds, 4)
+	// Images from before rotated views have no rotation.
+	rotation := 0.0
+	if _, ok := text[keyRotation]; ok {
+		rotation = p.floats(keyRotation, 1)[0]
+	}
+	settings.MaxIterations = p.int(keyMaxIterations)
+	settings.BailoutRadius = p.floats(keyBailoutRadius, 1)[0]
+	settings.Normalize = p.bool(keyNormalize)
+	settings.SampleRatio = p.int(keySampleRatio)
+	settings.ColorFrequency = p.floats(keyColorFrequency, 1)[0]
+	settings.ColorOffset = p.floats(keyColorOffset, 1)[0]
+	settings.Decomposition = Decomposition(p.int(keyDecomposition))
+	if p.err != nil {
+		return nil, settings, nil, p.err
+	}
+	v := Bounds{bounds[0], bounds[1], bounds[2], bounds[3]}.Viewport()
+	v.Rotation = rotation
+	fr.SetViewport(v)
+
+	var params []layerParams
+	if err := json.Unmarshal([]byte(text[keyLayers]), &params); err != nil {
+		return nil, settings, nil, fmt.Errorf("fractal: %s: %v", keyLayers, err)
+	}
+	if settings.Layers, err = layers(params); err != nil {
+		return nil, settings, nil, err
+	}
+	if err := settings.check(); err != nil {
+		return nil, settings, nil, err
+	}
+	return fr, settings, img, nil
+}
+
+func formatFloats(values ...float64) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strings.Join(s, " ")
+}
+
+// textParser parses text chunk values, keeping the first error.
+type textParser struct {
+	text map[string]string
+	err  error
+}
+
+func (p *textParser) fail(key string, err error) {
+	if p.err == nil {
+		p.err = fmt.Errorf("fractal: %s: %v", key, err)
+	}
+}
+
+func (p *textParser) int(key string) int {
+	v, err := strconv.Atoi(p.text[key])
+	if err != nil {
+		p.fail(key, err)
+	}
+	return v
+}
+
+func (p *textParser) bool(key string) bool {
+	v, err := strconv.ParseBool(p.text[key])
+	if err != nil {
+		p.fail(key, err)
+	}
+	return v
+}
+
+func (p *textParser) complex(key string) complex128 {
+	v, err := strconv.ParseComplex(p.text[key], 128)
+	if err != nil {
+		p.fail(key, err)
+	}
+	return v
+}
+
+// floats parses n space separated numbers.
+func (p *textParser) floats(key string, n int) []float64 {
+	values := make([]float64, n)
+	fields := strings.Fields(p.text[key])
+	if len(fields) != n {
+		p.fail(key, fmt.Errorf("expected %d numbers", n))
+		return values
+	}
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			p.fail(key, err)
+		}
+		values[i] = v
+	}
+	return values
+}
@@ -0,0 +1,199 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"io"
+	"saph/graphic"
+)
+
+// posterSamples bounds the samples of a poster strip, and so the memory
+// used while rendering a poster.
+const posterSamples = 1 << 22
+
+// Poster describes a render that is too large to be held in memory.
+type Poster struct {
+	graphic.Box
+	Deep     bool               // 16 bits per channel instead of 8
+	Progress func(done float64) // called after each strip, may be nil
+
+	// Checkpoint is a directory where the samples of finished strips are
+	// kept until the poster is done. Encoding the same poster again
+	// resumes from them instead of rendering them again.
+	Checkpoint string
+}
+
+// EncodePoster renders the fractal strip by strip straight into a PNG,
+// with the parameters stored as by EncodePNG. Only one strip of samples
+// is held in memory at a time.
+func (fr *Fractal) EncodePoster(w io.Writer, poster Poster, settings Settings) error {
+	if err := settings.check(); err != nil {
+		return err
+	}
+	p := fr.newPosterImage(poster, settings)
+	finished := 0
+	if poster.Checkpoint != "" {
+		info, err := fr.checkpointInfo(p, settings)
+		if err != nil {
+			return err
+		}
+		if p.checkpoint, err = openCheckpoint(poster.Checkpoint, info); err != nil {
+			return err
+		}
+		for _, top := range p.checkpoint.strips() {
+			finished += p.stripRows(top) * p.Width
+		}
+	}
+	p.resume(p.Width*p.Height, finished)
+	if p.Progress != nil {
+		p.Progress(p.GetProgress())
+	}
+
+	if err := fr.EncodePNG(w, p, settings); err != nil {
+		return err
+	}
+	if p.err != nil {
+		return p.err
+	}
+	if p.checkpoint != nil {
+		return p.checkpoint.remove()
+	}
+	return nil
+}
+
+// checkpointInfo identifies the samples of a poster: its parameters, its
+// size and how it is split into strips.
+func (fr *Fractal) checkpointInfo(p *posterImage, settings Settings) ([]byte, error) {
+	var params bytes.Buffer
+	if err := fr.SaveParams(&params, settings); err != nil {
+		return nil, err
+	}
+	info := struct {
+		Width, Height, StripHeight int
+		Params                     json.RawMessage
+	}{p.Width, p.Height, p.stripHeight, params.Bytes()}
+	return json.MarshalIndent(info, "", "\t")
+}
+
+// posterImage renders its rows on demand, one strip at a time. The PNG
+// encoder reads the rows top to bottom, so every strip is rendered once.
+type posterImage struct {
+	Poster
+	settings      Settings
+	view          Viewport
+	isMandelbrot  bool
+	juliaConstant complex128
+	stripHeight   int
+	top           int   // first row of the current strip
+	rows          []rgb // colors of the current strip
+	checkpoint    *checkpoint
+	err           error // first checkpoint error
+	progress
+}
+
+func (fr *Fractal) newPosterImage(poster Poster, settings Settings) *posterImage {
+	ratio := settings.SampleRatio
+	if ratio < 1 {
+		ratio = 1
+	}
+	stripHeight := posterSamples / (poster.Width * ratio * ratio)
+	if stripHeight < 1 {
+		stripHeight = 1
+	}
+	return &posterImage{
+		Poster:        poster,
+		settings:      settings,
+		view:          fr.Viewport(),
+		isMandelbrot:  fr.isMandelbrot,
+		juliaConstant: fr.juliaConstant,
+		stripHeight:   stripHeight,
+		top:           -1,
+	}
+}
+
+func (p *posterImage) ColorModel() color.Model {
+	if p.Deep {
+		return color.RGBA64Model
+	}
+	return color.RGBAModel
+}
+
+func (p *posterImage) Bounds() image.Rectangle { return image.Rect(0, 0, p.Width, p.Height) }
+func (p *posterImage) Opaque() bool            { return true }
+
+func (p *posterImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Bounds())) {
+		return color.RGBA{}
+	}
+	if p.top < 0 || y < p.top || y >= p.top+p.stripHeight {
+		p.render(y - y%p.stripHeight)
+	}
+	c := p.rows[(y-p.top)*p.Width+x]
+	if p.Deep {
+		return c.RGBA64()
+	}
+	return c.RGBA()
+}
+
+// stripRows is the number of rows of the strip starting at row top.
+func (p *posterImage) stripRows(top int) int {
+	if top+p.stripHeight > p.Height {
+		return p.Height - top
+	}
+	return p.stripHeight
+}
+
+// render renders the strip starting at row top, or loads its samples from
+// the checkpoint.
+func (p *posterImage) render(top int) {
+	bottom := top + p.stripRows(top)
+	// One more row on each side lets slope shading see the neighbours of
+	// the edge rows.
+	lo, hi := top, bottom
+	if lo > 0 {
+		lo--
+	}
+	if hi < p.Height {
+		hi++
+	}
+
+	view := p.view
+	view.Center = view.Point(p.Box, float64(p.Width)/2, float64(lo+hi)/2)
+	view.Height = p.view.Height * float64(hi-lo) / float64(p.Height)
+	strip := &Fractal{
+		view:          view,
+		isMandelbrot:  p.isMandelbrot,
+		juliaConstant: p.juliaConstant,
+	}
+	box := graphic.Box{Width: p.Width, Height: hi - lo}
+	strip.newRequest(box.Width * box.Height)
+	strip.buffer = newBuffer(box, p.settings, view.Width/float64(p.Width))
+	if p.checkpoint == nil || !p.checkpoint.load(top, strip.buffer.Samples) {
+		rs := newRenderSettings(box, p.settings)
+		strip.renderArea(rs, nil, image.Rect(0, 0, box.Width, box.Height))
+		p.elementsFinished(p.Width * (bottom - top))
+		if p.checkpoint != nil {
+			if err := p.checkpoint.save(top, strip.buffer.Samples); err != nil && p.err == nil {
+				p.err = err
+			}
+		}
+	}
+
+	p.top = top
+	if len(p.rows) != p.Width*p.stripHeight {
+		p.rows = make([]rgb, p.Width*p.stripHeight)
+	}
+	strip.buffer.colorFloat(p.settings, func(x, y int, c rgb) {
+		if row := y + lo; row >= top && row < bottom {
+			p.rows[(row-top)*p.Width+x] = c
+		}
+	})
+	if p.Progress != nil {
+		p.Progress(p.GetProgress())
+	}
+}
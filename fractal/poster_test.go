@@ -0,0 +1,83 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"reflect"
+	"saph/graphic"
+	"testing"
+)
+
+// Posters rendered in strips look like the same image rendered at once,
+// slope shading included.
+func TestPosterStrips(t *testing.T) {
+	size := graphic.Box{Width: 40, Height: 30}
+	fr, s := testFractal(), testSettings()
+	if count(fr.Render(size, s)) != size.Width*size.Height {
+		t.Fatal("Render failed")
+	}
+	want := fr.Buffer().Image(s)
+
+	p := fr.newPosterImage(Poster{Box: size}, s)
+	p.stripHeight = 7
+	p.resume(size.Width*size.Height, 0)
+	var differ int
+	for y := 0; y < size.Height; y++ {
+		for x := 0; x < size.Width; x++ {
+			if !closeRGBA(p.At(x, y).(color.RGBA), want.RGBAAt(x, y), 2) {
+				differ++
+			}
+		}
+	}
+	if differ > 0 {
+		t.Errorf("%d of %d pixels differ from a single render", differ, size.Width*size.Height)
+	}
+	if p.GetProgress() != 1 {
+		t.Errorf("progress %g after all strips, want 1", p.GetProgress())
+	}
+}
+
+func TestEncodePoster(t *testing.T) {
+	size := graphic.Box{Width: 12, Height: 9}
+	fr, s := testFractal(), testSettings()
+	for _, deep := range []bool{false, true} {
+		var progress []float64
+		poster := Poster{Box: size, Deep: deep, Progress: func(done float64) { progress = append(progress, done) }}
+		var buf bytes.Buffer
+		if err := fr.EncodePoster(&buf, poster, s); err != nil {
+			t.Fatal(err)
+		}
+		_, loaded, img, err := DecodePNG(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds() != image.Rect(0, 0, size.Width, size.Height) {
+			t.Errorf("deep %v: bounds %v", deep, img.Bounds())
+		}
+		if _, ok := img.(*image.RGBA64); ok != deep {
+			t.Errorf("deep %v: decoded a %T", deep, img)
+		}
+		if !reflect.DeepEqual(loaded, s) {
+			t.Errorf("deep %v: settings %+v, want %+v", deep, loaded, s)
+		}
+		if len(progress) == 0 || progress[len(progress)-1] != 1 {
+			t.Errorf("deep %v: progress %v, want it to end at 1", deep, progress)
+		}
+	}
+
+	s.MaxIterations = 0
+	if err := fr.EncodePoster(new(bytes.Buffer), Poster{Box: size}, s); err == nil {
+		t.Error("EncodePoster succeeded with invalid settings")
+	}
+}
+
+// closeRGBA reports whether a and b differ by at most tolerance in each
+// channel.
+func closeRGBA(a, b color.RGBA, tolerance int) bool {
+	d := func(x, y uint8) bool { return int(x)-int(y) <= tolerance && int(y)-int(x) <= tolerance }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && d(a.A, b.A)
+}
@@ -20,6 +20,12 @@ func (s *progress) newRequest(requestedElements int) {
 	s.finishedElements = 0
 }
 
+// resume starts a request of which finishedElements are already done.
+func (s *progress) resume(requestedElements, finishedElements int) {
+	s.newRequest(requestedElements)
+	s.elementsFinished(finishedElements)
+}
+
 func (s *progress) IsFinished() bool {
 	s.Lock()
 	defer s.Unlock()
@@ -27,9 +33,13 @@ func (s *progress) IsFinished() bool {
 }
 
 func (s *progress) elementFinished() {
+	s.elementsFinished(1)
+}
+
+func (s *progress) elementsFinished(n int) {
 	s.Lock()
 	defer s.Unlock()
-	s.finishedElements++
+	s.finishedElements += n
 	if s.finishedElements == s.requestedElements {
 		s.isFinished = true
 	}
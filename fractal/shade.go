@@ -0,0 +1,70 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import "math"
+
+// Lighting describes the directional light of slope layers, which treat
+// the continuous iteration count of a render as a heightfield. The angles
+// are in radians; the azimuth is measured counterclockwise from the positive
+// real axis and the elevation from the image plane.
+type Lighting struct {
+	Azimuth     float64
+	Elevation   float64
+	HeightScale float64 // steepness of the heightfield
+	Ambient     float64 // light reaching every pixel, 0 <= Ambient <= 1
+	Specular    float64 // strength of the Blinn-Phong highlight, 0 turns it off
+	Shininess   float64 // Blinn-Phong exponent
+}
+
+// DefaultLighting is a light from the upper left.
+var DefaultLighting = Lighting{
+	Azimuth:     3 * math.Pi / 4,
+	Elevation:   math.Pi / 4,
+	HeightScale: 8,
+	Ambient:     0.3,
+	Specular:    0.2,
+	Shininess:   20,
+}
+
+// light returns the diffuse and specular light at the pixel x, y.
+func (b *Buffer) light(x, y int, light Lighting) (diffuse, specular float64) {
+	// The logarithm keeps the slopes comparable near the set, where the
+	// iteration count grows without bound.
+	h := func(x, y int) float64 {
+		return math.Log1p(b.height(clamp(x, 0, b.Width-1), clamp(y, 0, b.Height-1)))
+	}
+
+	lx := math.Cos(light.Elevation) * math.Cos(light.Azimuth)
+	ly := math.Cos(light.Elevation) * math.Sin(light.Azimuth)
+	lz := math.Sin(light.Elevation)
+
+	// Image rows grow downwards, the heightfield's y axis upwards.
+	dx := (h(x+1, y) - h(x-1, y)) / 2 * light.HeightScale
+	dy := (h(x, y-1) - h(x, y+1)) / 2 * light.HeightScale
+	nx, ny, nz := normalize(-dx, -dy, 1)
+
+	diffuse = math.Max(0, nx*lx+ny*ly+nz*lz)
+	if light.Specular > 0 {
+		// Halfway vector between the light and a viewer straight above.
+		hx, hy, hz := normalize(lx, ly, lz+1)
+		specular = light.Specular * math.Pow(math.Max(0, nx*hx+ny*hy+nz*hz), light.Shininess)
+	}
+	return diffuse, specular
+}
+
+func normalize(x, y, z float64) (float64, float64, float64) {
+	l := math.Sqrt(x*x + y*y + z*z)
+	return x / l, y / l, z / l
+}
+
+func clamp(x, lo, hi int) int {
+	if x < lo {
+		return lo
+	}
+	if x > hi {
+		return hi
+	}
+	return x
+}
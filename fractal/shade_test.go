@@ -0,0 +1,101 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"math"
+	"saph/graphic"
+	"saph/graphic/palette"
+	"testing"
+)
+
+// rampBuffer is a buffer whose smooth iteration count grows by one per
+// column. Samples escaping with |z| = 10 have a smooth count of exactly N.
+func rampBuffer() *Buffer {
+	b := &Buffer{Box: graphic.Box{Width: 5, Height: 3}, SampleRatio: 1, MaxIterations: 100, PixelSize: 0.01}
+	b.Samples = make([]Sample, 5*3)
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 5; x++ {
+			b.pixel(x, y)[0] = Sample{N: int32(10 + x), Z: 10}
+		}
+	}
+	return b
+}
+
+func TestLightFlat(t *testing.T) {
+	light := Lighting{Azimuth: 1, Elevation: math.Pi / 6, HeightScale: 0, Ambient: 0.3}
+	diffuse, specular := rampBuffer().light(2, 1, light)
+	// Without height the normal points straight up.
+	if want := math.Sin(light.Elevation); math.Abs(diffuse-want) > 1e-12 {
+		t.Errorf("diffuse %g, want %g", diffuse, want)
+	}
+	if specular != 0 {
+		t.Errorf("specular %g without a highlight", specular)
+	}
+
+	light.Specular, light.Shininess = 0.5, 4
+	_, specular = rampBuffer().light(2, 1, light)
+	// The halfway vector between the light and the viewer.
+	lz := math.Sin(light.Elevation)
+	hz := (lz + 1) / math.Sqrt(math.Cos(light.Elevation)*math.Cos(light.Elevation)+(lz+1)*(lz+1))
+	if want := 0.5 * math.Pow(hz, 4); math.Abs(specular-want) > 1e-12 {
+		t.Errorf("specular %g, want %g", specular, want)
+	}
+}
+
+func TestLightSlope(t *testing.T) {
+	b := rampBuffer()
+	// The ramp rises to the right, so it faces a light from the left.
+	fromLeft := Lighting{Azimuth: math.Pi, Elevation: math.Pi / 4, HeightScale: 8}
+	fromRight := fromLeft
+	fromRight.Azimuth = 0
+	left, _ := b.light(2, 1, fromLeft)
+	right, _ := b.light(2, 1, fromRight)
+	flat := math.Sin(fromLeft.Elevation)
+	if !(left > flat && right < flat) {
+		t.Errorf("diffuse light from the left %g and right %g, flat %g", left, right, flat)
+	}
+
+	dx := (math.Log1p(13) - math.Log1p(11)) / 2 * 8
+	nx, _, nz := normalize(-dx, 0, 1)
+	want := nx*math.Cos(math.Pi/4)*math.Cos(math.Pi) + nz*math.Sin(math.Pi/4)
+	if math.Abs(left-want) > 1e-12 {
+		t.Errorf("diffuse %g, want %g", left, want)
+	}
+	// Facing away from the light is dark, not negative.
+	steep := Lighting{Azimuth: 0, Elevation: 0.01, HeightScale: 100}
+	if d, _ := b.light(2, 1, steep); d != 0 {
+		t.Errorf("diffuse %g facing away from the light", d)
+	}
+}
+
+func TestSlopeLayer(t *testing.T) {
+	b := rampBuffer()
+	// The rightmost column is inside the set.
+	for y := 0; y < 3; y++ {
+		b.pixel(4, y)[0].N = 100
+	}
+	white := palette.Palette{palette.White}
+	light := Lighting{Azimuth: 1, Elevation: math.Pi / 2, Ambient: 0.25}
+	s := Settings{
+		MaxIterations: 100,
+		SampleRatio:   1,
+		Layers:        []Layer{NewPaletteLayer(white, palette.White), NewSlopeLayer(light)},
+	}
+	img := b.Image(s)
+	// A light from straight above lights a flat field fully.
+	if c := img.RGBAAt(0, 1); c != palette.White {
+		t.Errorf("lit pixel %v, want white", c)
+	}
+	light.Elevation = 0
+	s.Layers[1] = NewSlopeLayer(light)
+	img = b.Image(s)
+	// Grazing light leaves only the ambient light, and the set unshaded.
+	if c := img.RGBAAt(0, 1); c.R != 64 || c.G != 64 || c.B != 64 {
+		t.Errorf("pixel lit by ambient light only %v, want grey 64", c)
+	}
+	if c := img.RGBAAt(4, 1); c != palette.White {
+		t.Errorf("pixel inside the set %v, want white", c)
+	}
+}
@@ -0,0 +1,77 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"math/cmplx"
+	"saph/graphic"
+)
+
+// Viewport is the part of the complex plane shown in an image: a Width by
+// Height rectangle around Center, turned Rotation radians counterclockwise.
+// Image rows grow along the imaginary axis of the rectangle, columns along
+// its real axis.
+type Viewport struct {
+	Center        complex128
+	Width, Height float64
+	Rotation      float64
+}
+
+// Viewport returns the view of the rectangle b, without rotation.
+func (b Bounds) Viewport() Viewport {
+	return Viewport{
+		Center: complex((b.XMin+b.XMax)/2, (b.YMin+b.YMax)/2),
+		Width:  b.XMax - b.XMin,
+		Height: b.YMax - b.YMin,
+	}
+}
+
+// Bounds returns the rectangle of the view before it is rotated.
+func (v Viewport) Bounds() Bounds {
+	x, y := real(v.Center), imag(v.Center)
+	return Bounds{x - v.Width/2, y - v.Height/2, x + v.Width/2, y + v.Height/2}
+}
+
+// Fit returns the view with its height changed to make the pixels of an
+// image of size square.
+func (v Viewport) Fit(size graphic.Box) Viewport {
+	v.Height = v.Width * float64(size.Height) / float64(size.Width)
+	return v
+}
+
+// Zoom returns the view magnified factor times around the position x, y
+// in an image of size, keeping the point there in place. Factors below 1
+// zoom out.
+func (v Viewport) Zoom(size graphic.Box, x, y, factor float64) Viewport {
+	p := v.Point(size, x, y)
+	v.Center = p + (v.Center-p)/complex(factor, 0)
+	v.Width /= factor
+	v.Height /= factor
+	return v
+}
+
+// steps returns the distance in the complex plane between neighbouring
+// columns and rows of an image of size.
+func (v Viewport) steps(size graphic.Box) (col, row complex128) {
+	turn := cmplx.Rect(1, v.Rotation)
+	col = complex(v.Width/float64(size.Width), 0) * turn
+	row = complex(0, v.Height/float64(size.Height)) * turn
+	return col, row
+}
+
+// Point returns the point of the complex plane at the position x, y in an
+// image of size. Whole positions are the top left corners of pixels.
+func (v Viewport) Point(size graphic.Box, x, y float64) complex128 {
+	col, row := v.steps(size)
+	return v.Center + col*complex(x-float64(size.Width)/2, 0) + row*complex(y-float64(size.Height)/2, 0)
+}
+
+// Pixel returns the position of the point p in an image of size, the
+// inverse of Point.
+func (v Viewport) Pixel(size graphic.Box, p complex128) (x, y float64) {
+	d := (p - v.Center) * cmplx.Rect(1, -v.Rotation)
+	x = real(d)/v.Width*float64(size.Width) + float64(size.Width)/2
+	y = imag(d)/v.Height*float64(size.Height) + float64(size.Height)/2
+	return x, y
+}
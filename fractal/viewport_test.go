@@ -0,0 +1,99 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package fractal
+
+import (
+	"math"
+	"math/cmplx"
+	"saph/graphic"
+	"testing"
+)
+
+var testViews = []Viewport{
+	{Center: complex(-0.5, 0), Width: 3, Height: 2},
+	{Center: complex(0.1, -0.2), Width: 0.5, Height: 0.3, Rotation: 0.4},
+	{Center: complex(-0.7435, 0.1314), Width: 1e-6, Height: 6e-7, Rotation: -2},
+}
+
+func TestViewportPoint(t *testing.T) {
+	size := graphic.Box{Width: 300, Height: 200}
+	v := testViews[0]
+	// Without rotation the image spans the bounds, columns along the real
+	// axis and rows along the imaginary one.
+	b := v.Bounds()
+	for _, c := range []struct {
+		x, y float64
+		want complex128
+	}{
+		{0, 0, complex(b.XMin, b.YMin)},
+		{300, 0, complex(b.XMax, b.YMin)},
+		{0, 200, complex(b.XMin, b.YMax)},
+		{150, 100, v.Center},
+	} {
+		if p := v.Point(size, c.x, c.y); cmplx.Abs(p-c.want) > 1e-12 {
+			t.Errorf("Point(%g, %g) = %v, want %v", c.x, c.y, p, c.want)
+		}
+	}
+
+	// A quarter turn puts the columns along the imaginary axis.
+	v.Rotation = math.Pi / 2
+	if p := v.Point(size, 300, 100); cmplx.Abs(p-(v.Center+complex(0, 1.5))) > 1e-12 {
+		t.Errorf("turned Point(300, 100) = %v, want %v", p, v.Center+complex(0, 1.5))
+	}
+}
+
+func TestViewportPixel(t *testing.T) {
+	size := graphic.Box{Width: 640, Height: 384}
+	for _, v := range testViews {
+		for _, pos := range [][2]float64{{0, 0}, {640, 384}, {12.5, 300.25}, {320, 192}} {
+			x, y := v.Pixel(size, v.Point(size, pos[0], pos[1]))
+			if math.Abs(x-pos[0]) > 1e-6 || math.Abs(y-pos[1]) > 1e-6 {
+				t.Errorf("%+v: Pixel(Point(%g, %g)) = %g, %g", v, pos[0], pos[1], x, y)
+			}
+		}
+	}
+}
+
+func TestViewportZoom(t *testing.T) {
+	size := graphic.Box{Width: 640, Height: 384}
+	for _, v := range testViews {
+		for _, factor := range []float64{2, 0.5, 10} {
+			x, y := 100.0, 50.0
+			z := v.Zoom(size, x, y, factor)
+			if p, q := v.Point(size, x, y), z.Point(size, x, y); cmplx.Abs(p-q) > 1e-9*v.Width {
+				t.Errorf("%+v zoomed %g times: point at %g, %g moved from %v to %v", v, factor, x, y, p, q)
+			}
+			if math.Abs(z.Width*factor-v.Width) > 1e-12*v.Width || math.Abs(z.Height*factor-v.Height) > 1e-12*v.Height {
+				t.Errorf("%+v zoomed %g times: size %g x %g", v, factor, z.Width, z.Height)
+			}
+			if z.Rotation != v.Rotation {
+				t.Errorf("%+v zoomed %g times: rotation %g", v, factor, z.Rotation)
+			}
+		}
+	}
+}
+
+func TestViewportFit(t *testing.T) {
+	v := testViews[1].Fit(graphic.Box{Width: 400, Height: 100})
+	if v.Width != 0.5 || v.Height != 0.125 || v.Center != testViews[1].Center || v.Rotation != 0.4 {
+		t.Errorf("Fit: %+v", v)
+	}
+}
+
+func TestBoundsViewport(t *testing.T) {
+	b := Bounds{-2.5, -1.5, 1.0, 1.5}
+	if got := b.Viewport().Bounds(); got != b {
+		t.Errorf("Bounds round trip: %v, want %v", got, b)
+	}
+}
+
+func TestZoomAt(t *testing.T) {
+	size := graphic.Box{Width: 300, Height: 200}
+	fr := testFractal()
+	before := fr.Viewport()
+	fr.ZoomAt(size, 30, 170, 4)
+	if p, q := before.Point(size, 30, 170), fr.Viewport().Point(size, 30, 170); cmplx.Abs(p-q) > 1e-12 {
+		t.Errorf("ZoomAt moved the point under the pointer from %v to %v", p, q)
+	}
+}
@@ -0,0 +1,228 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/gdkpixbuf"
+	"github.com/mattn/go-gtk/glib"
+	"github.com/mattn/go-gtk/gtk"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+)
+
+const (
+	thumbnailWidth = 128
+	bookmarkPanelW = 160
+)
+
+// A bookmark is a parameter file in the bookmark directory, with a PNG
+// thumbnail of the same name next to it.
+var (
+	bookmarkBox  *gtk.VBox // holds bookmarkList
+	bookmarkList *gtk.VBox
+)
+
+// bookmarkDir is the directory bookmarks are kept in.
+func bookmarkDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.Getenv("HOME")
+	}
+	return filepath.Join(dir, "fractalExplorer", "bookmarks")
+}
+
+// bookmarkNames lists the bookmarks in alphabetical order.
+func bookmarkNames() []string {
+	infos, err := ioutil.ReadDir(bookmarkDir())
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, info := range infos {
+		if name := info.Name(); !info.IsDir() && strings.HasSuffix(name, ".json") {
+			names = append(names, strings.TrimSuffix(name, ".json"))
+		}
+	}
+	return names
+}
+
+// addBookmark saves the current fractal and settings as a bookmark, with a
+// thumbnail of the current image.
+func addBookmark(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || name[0] == '.' {
+		return fmt.Errorf("invalid bookmark name %q", name)
+	}
+	buffer := frac.Buffer()
+	if buffer == nil {
+		return errors.New("nothing to bookmark")
+	}
+	dir := bookmarkDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	base := filepath.Join(dir, name)
+
+	file, err := os.Create(base + ".json")
+	if err != nil {
+		return err
+	}
+	if err := frac.SaveParams(file, settings); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	file, err = os.Create(base + ".png")
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, thumbnail(buffer.Image(settings), thumbnailWidth)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func removeBookmark(name string) error {
+	base := filepath.Join(bookmarkDir(), name)
+	if err := os.Remove(base + ".json"); err != nil {
+		return err
+	}
+	if err := os.Remove(base + ".png"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// thumbnail scales img down to width pixels wide, averaging the pixels
+// that fall into each thumbnail pixel.
+func thumbnail(img *image.RGBA, width int) *image.RGBA {
+	b := img.Bounds()
+	if width > b.Dx() {
+		width = b.Dx()
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/height, b.Min.Y+(y+1)*b.Dy()/height
+		for x := 0; x < width; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/width, b.Min.X+(x+1)*b.Dx()/width
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := img.PixOffset(sx, sy)
+					for c := range sum {
+						sum[c] += int(img.Pix[i+c])
+					}
+				}
+			}
+			n := (x1 - x0) * (y1 - y0)
+			i := thumb.PixOffset(x, y)
+			for c := range sum {
+				thumb.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return thumb
+}
+
+//~~~~~~~~~~~~ Panel - Bookmarks ~~~~~~~~~~~~
+
+// newBookmarkPanel returns the side panel listing the bookmarks.
+func newBookmarkPanel() gtk.IWidget {
+	frame := gtk.NewFrame("Bookmarks")
+	frame.SetSizeRequest(bookmarkPanelW, -1)
+	scrolled := gtk.NewScrolledWindow(nil, nil)
+	scrolled.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	frame.Add(scrolled)
+	bookmarkBox = gtk.NewVBox(false, 0)
+	scrolled.AddWithViewPort(bookmarkBox)
+	updateBookmarkPanel()
+	return frame
+}
+
+// updateBookmarkPanel lists the bookmarks found on disk again.
+func updateBookmarkPanel() {
+	if bookmarkList != nil {
+		bookmarkList.Destroy()
+	}
+	bookmarkList = gtk.NewVBox(false, 5)
+	bookmarkBox.PackStart(bookmarkList, false, false, 0)
+	for _, name := range bookmarkNames() {
+		bookmarkList.PackStart(newBookmarkButton(name), false, false, 0)
+	}
+	bookmarkList.ShowAll()
+}
+
+// newBookmarkButton returns a button with the thumbnail and name of a
+// bookmark that renders it when clicked. Right clicking removes it.
+func newBookmarkButton(name string) gtk.IWidget {
+	base := filepath.Join(bookmarkDir(), name)
+	vbox := gtk.NewVBox(false, 2)
+	if pixbuf, err := gdkpixbuf.NewPixbufFromFile(base + ".png"); err == nil {
+		vbox.PackStart(gtk.NewImageFromPixbuf(pixbuf), false, false, 0)
+	}
+	vbox.PackStart(gtk.NewLabel(name), false, false, 0)
+
+	button := gtk.NewButton()
+	button.Add(vbox)
+	button.SetTooltipText("Right click to remove")
+	button.Clicked(func() {
+		if frac.IsFinished() {
+			openParams(base + ".json")
+		}
+	})
+	button.Connect("button-press-event", func(ctx *glib.CallbackContext) {
+		event := (*gdk.EventButton)(unsafe.Pointer(ctx.Args(0)))
+		if event.Button != 3 {
+			return
+		}
+		dialog := gtk.NewMessageDialog(window, gtk.DIALOG_MODAL, gtk.MESSAGE_QUESTION, gtk.BUTTONS_YES_NO,
+			"Remove the bookmark %q?", name)
+		answer := dialog.Run()
+		dialog.Destroy()
+		if answer != gtk.RESPONSE_YES {
+			return
+		}
+		if err := removeBookmark(name); err != nil {
+			showError(err)
+		}
+		updateBookmarkPanel()
+	})
+	return button
+}
+
+// askBookmark asks for the name of a new bookmark.
+func askBookmark() (string, bool) {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Add bookmark")
+	dialog.SetTransientFor(window)
+	defer dialog.Destroy()
+
+	nameEntry := gtk.NewEntry()
+	hbox := gtk.NewHBox(false, 5)
+	hbox.PackStart(gtk.NewLabel("Name"), false, false, 0)
+	hbox.PackStart(nameEntry, true, true, 0)
+	dialog.GetVBox().PackStart(hbox, false, false, 5)
+	dialog.AddButton(gtk.STOCK_CANCEL, gtk.RESPONSE_CANCEL)
+	dialog.AddButton(gtk.STOCK_OK, gtk.RESPONSE_OK)
+	dialog.ShowAll()
+	if dialog.Run() != gtk.RESPONSE_OK {
+		return "", false
+	}
+	return strings.TrimSpace(nameEntry.GetText()), true
+}
@@ -0,0 +1,120 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"github.com/mattn/go-gtk/gdk"
+	"image"
+	"saph/graphic"
+)
+
+const (
+	boxStep   = 1.25 // change of the box size per ctrl+scroll step
+	boxMin    = 0.02 // smallest box, as a fraction of the window
+	boxMax    = 0.9  // largest box
+	dragSlack = 4    // pixels the pointer may move during a click
+)
+
+// boxZoom is the zoom box of the drawing area: a box the size of the next
+// zoom that follows the pointer, or the region selected by dragging.
+type boxZoom struct {
+	scale    float64 // size of the box, as a fraction of the window
+	pointer  image.Point
+	inside   bool // the pointer is over the drawing area
+	dragging bool
+	start    image.Point // where the drag started
+	gc       *gdk.GC
+}
+
+var zoomBox = &boxZoom{scale: 1.0 / clickZoom}
+
+// rect is the region shown after the next zoom in.
+func (b *boxZoom) rect() image.Rectangle {
+	if b.dragging && b.dragged() {
+		return b.selection()
+	}
+	w := int(float64(imageSize.Width)*b.scale + 0.5)
+	h := int(float64(imageSize.Height)*b.scale + 0.5)
+	min := image.Point{b.pointer.X - w/2, b.pointer.Y - h/2}
+	return image.Rectangle{min, min.Add(image.Point{w, h})}
+}
+
+func (b *boxZoom) dragged() bool {
+	d := b.pointer.Sub(b.start)
+	return abs(d.X) > dragSlack || abs(d.Y) > dragSlack
+}
+
+// selection is the rectangle dragged out from the start towards the
+// pointer, widened to the shape of the window.
+func (b *boxZoom) selection() image.Rectangle {
+	dx, dy := b.pointer.X-b.start.X, b.pointer.Y-b.start.Y
+	w, h := abs(dx), abs(dy)
+	if w*imageSize.Height > h*imageSize.Width {
+		h = w * imageSize.Height / imageSize.Width
+	} else {
+		w = h * imageSize.Width / imageSize.Height
+	}
+	if dx < 0 {
+		w = -w
+	}
+	if dy < 0 {
+		h = -h
+	}
+	return image.Rectangle{b.start, b.start.Add(image.Point{w, h})}.Canon()
+}
+
+// resize grows or shrinks the box by steps of boxStep.
+func (b *boxZoom) resize(grow bool) {
+	if grow {
+		b.scale *= boxStep
+	} else {
+		b.scale /= boxStep
+	}
+	if b.scale < boxMin {
+		b.scale = boxMin
+	}
+	if b.scale > boxMax {
+		b.scale = boxMax
+	}
+}
+
+// draw outlines the box on drawable, unless a render is running.
+func (b *boxZoom) draw(drawable *gdk.Drawable) {
+	if !b.inside && !b.dragging || !frac.IsFinished() {
+		return
+	}
+	if b.gc == nil {
+		b.gc = gdk.NewGC(drawable)
+		b.gc.SetRgbFgColor(gdk.NewColor("white"))
+	}
+	r := b.rect()
+	drawable.DrawRectangle(b.gc, false, r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+}
+
+// zoomIn magnifies the region r of the window to fill it.
+func zoomIn(r image.Rectangle) {
+	if r.Dx() <= 0 || r.Dy() <= 0 {
+		return
+	}
+	center := image.Point{(r.Min.X + r.Max.X) / 2, (r.Min.Y + r.Max.Y) / 2}
+	frac.Magnify(imageSize, graphic.Box{Width: r.Dx(), Height: r.Dy()}, center)
+	render()
+}
+
+// zoomOut shrinks the view into a box around p the size of the zoom box.
+func zoomOut(p image.Point) {
+	size := graphic.Box{
+		Width:  int(float64(imageSize.Width)/zoomBox.scale + 0.5),
+		Height: int(float64(imageSize.Height)/zoomBox.scale + 0.5),
+	}
+	frac.Magnify(imageSize, size, p)
+	render()
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
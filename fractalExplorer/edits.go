@@ -0,0 +1,178 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"github.com/mattn/go-gtk/gtk"
+	"image/color"
+	"saph/fractal"
+	"saph/graphic/palette"
+	"strconv"
+)
+
+// edits are the settings widgets the user changed since the latest render.
+// A render applies only them to the current settings, so that what the
+// widgets cannot show, such as the opacity and blending of layers, is kept.
+var edits = make(map[interface{}]bool)
+
+// mirroring is set while the widgets are made to show the settings, which
+// is not an edit.
+var mirroring bool
+
+// trackEdits notes the changes of the settings widgets in edits. Until the
+// first render all of them count as edited.
+func trackEdits() {
+	for _, e := range []*gtk.Entry{maxIterationsEntry, bailoutRadiusEntry, colorFrequencyEntry} {
+		e := e
+		e.Connect("changed", func() { noteEdit(e) })
+		edits[e] = true
+	}
+	for _, b := range []*gtk.CheckButton{normalizeCheckbutton, fieldLinesCheckbutton,
+		glowCheckbutton, orbitTrapCheckbutton, shadingCheckbutton} {
+		b := b
+		b.Connect("toggled", func() { noteEdit(b) })
+		edits[b] = true
+	}
+	for _, c := range []*gtk.ComboBoxText{multisampleComboBoxText, paletteComboBoxText,
+		setColorComboBoxText, decompositionComboBoxText} {
+		c := c
+		c.Connect("changed", func() { noteEdit(c) })
+		edits[c] = true
+	}
+}
+
+func noteEdit(widget interface{}) {
+	if !mirroring {
+		edits[widget] = true
+	}
+}
+
+// mirror runs f, which changes widgets to show the settings.
+func mirror(f func()) {
+	mirroring = true
+	defer func() { mirroring = false }()
+	f()
+}
+
+// applyEdits returns s changed by the edited widgets. Turning a layer on
+// adds it with default parameters on top, turning it off removes it.
+func applyEdits(s fractal.Settings) fractal.Settings {
+	if edits[maxIterationsEntry] {
+		s.MaxIterations, _ = strconv.Atoi(maxIterationsEntry.GetText())
+	}
+	if edits[bailoutRadiusEntry] {
+		s.BailoutRadius, _ = strconv.ParseFloat(bailoutRadiusEntry.GetText(), 64)
+		// Orbits escaping within the unit circle have no smooth coloring.
+		if s.BailoutRadius <= 1 {
+			s.BailoutRadius = 2
+			mirror(func() { bailoutRadiusEntry.SetText("2") })
+		}
+	}
+	if edits[normalizeCheckbutton] {
+		s.Normalize = normalizeCheckbutton.GetActive()
+	}
+	if edits[multisampleComboBoxText] {
+		s.SampleRatio = 4 - multisampleComboBoxText.GetActive()
+	}
+	if edits[colorFrequencyEntry] {
+		s.ColorFrequency, _ = strconv.ParseFloat(colorFrequencyEntry.GetText(), 64)
+	}
+	if edits[decompositionComboBoxText] {
+		s.Decomposition &= fractal.FieldLines
+		switch decompositionComboBoxText.GetActive() {
+		case 1:
+			s.Decomposition |= fractal.BinaryDecomposition
+		case 2:
+			s.Decomposition |= fractal.AngleDecomposition
+		case 3:
+			s.Decomposition |= fractal.BinaryDecomposition | fractal.AngleDecomposition
+		}
+	}
+	if edits[fieldLinesCheckbutton] {
+		s.Decomposition &^= fractal.FieldLines
+		if fieldLinesCheckbutton.GetActive() {
+			s.Decomposition |= fractal.FieldLines
+		}
+	}
+
+	if edits[paletteComboBoxText] || edits[setColorComboBoxText] {
+		if !hasLayer(s, fractal.PaletteLayer) {
+			layers := []fractal.Layer{fractal.NewPaletteLayer(selectedPalette(), selectedSetColor())}
+			s.Layers = append(layers, s.Layers...)
+		}
+		if edits[paletteComboBoxText] {
+			s = withPalette(s, selectedPalette())
+		}
+		if edits[setColorComboBoxText] {
+			s = withSetColor(s, selectedSetColor())
+		}
+	}
+	if edits[orbitTrapCheckbutton] {
+		s = withLayer(s, orbitTrapCheckbutton.GetActive(),
+			fractal.NewOrbitTrapLayer(selectedPalette(), orbitTrapPoint, orbitTrapWidth))
+	}
+	if edits[glowCheckbutton] {
+		s = withLayer(s, glowCheckbutton.GetActive(), fractal.NewGlowLayer(palette.White, glowWidth))
+	}
+	if edits[shadingCheckbutton] {
+		s = withLayer(s, shadingCheckbutton.GetActive(), fractal.NewSlopeLayer(lighting))
+	}
+	return s
+}
+
+func selectedPalette() palette.Palette {
+	p, ok := palettes.Palette(paletteComboBoxText.GetActiveText())
+	if !ok {
+		p, _ = palettes.Palette(palettes.PaletteNames()[0])
+	}
+	return p
+}
+
+func selectedSetColor() color.RGBA {
+	c, ok := palettes.Color(setColorComboBoxText.GetActiveText())
+	if !ok {
+		c = palette.Black
+	}
+	return c
+}
+
+func hasLayer(s fractal.Settings, kind fractal.LayerKind) bool {
+	for _, l := range s.Layers {
+		if l.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// withLayer returns s with l added on top if on and s has no layer of its
+// kind, or with the layers of its kind removed if not on.
+func withLayer(s fractal.Settings, on bool, l fractal.Layer) fractal.Settings {
+	if on == hasLayer(s, l.Kind) {
+		return s
+	}
+	if on {
+		s.Layers = append(append([]fractal.Layer(nil), s.Layers...), l)
+		return s
+	}
+	var layers []fractal.Layer
+	for _, m := range s.Layers {
+		if m.Kind != l.Kind {
+			layers = append(layers, m)
+		}
+	}
+	s.Layers = layers
+	return s
+}
+
+// withSetColor returns s with the set color of its palette layers replaced.
+func withSetColor(s fractal.Settings, c color.RGBA) fractal.Settings {
+	s.Layers = append([]fractal.Layer(nil), s.Layers...)
+	for i := range s.Layers {
+		if s.Layers[i].Kind == fractal.PaletteLayer {
+			s.Layers[i].SetColor = c
+		}
+	}
+	return s
+}
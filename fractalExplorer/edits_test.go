@@ -0,0 +1,40 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"reflect"
+	"saph/fractal"
+	"saph/graphic/palette"
+	"testing"
+)
+
+// Turning a layer on or off leaves the other layers as they are.
+func TestWithLayer(t *testing.T) {
+	base := fractal.NewPaletteLayer(palette.Palette{palette.Black, palette.White}, palette.Red)
+	base.Opacity = 0.5
+	glow := fractal.NewGlowLayer(palette.Blue, 9)
+	glow.Blend = fractal.SoftLight
+	s := fractal.Settings{Layers: []fractal.Layer{base, glow}}
+	slope := fractal.NewSlopeLayer(fractal.DefaultLighting)
+
+	got := withLayer(s, true, slope)
+	if want := []fractal.Layer{base, glow, slope}; !reflect.DeepEqual(got.Layers, want) {
+		t.Errorf("adding: got %+v, want %+v", got.Layers, want)
+	}
+	if got := withLayer(s, true, fractal.NewGlowLayer(palette.White, 4)); !reflect.DeepEqual(got.Layers, s.Layers) {
+		t.Errorf("adding a present layer: got %+v, want %+v", got.Layers, s.Layers)
+	}
+	if got := withLayer(s, false, fractal.NewGlowLayer(palette.White, 4)); !reflect.DeepEqual(got.Layers, []fractal.Layer{base}) {
+		t.Errorf("removing: got %+v, want %+v", got.Layers, []fractal.Layer{base})
+	}
+	if !reflect.DeepEqual(s.Layers, []fractal.Layer{base, glow}) {
+		t.Error("withLayer changed the layers of its argument")
+	}
+
+	got = withSetColor(s, palette.Green)
+	if got.Layers[0].SetColor != palette.Green || got.Layers[0].Opacity != 0.5 || s.Layers[0].SetColor != palette.Red {
+		t.Errorf("withSetColor: got %+v from %+v", got.Layers[0], s.Layers[0])
+	}
+}
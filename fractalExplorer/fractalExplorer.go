@@ -5,12 +5,6 @@ package main
 
 /**
  * TODO: 
- * Implement scaleable box cursor:
- *	gdk_bitmap_create_from_data
- *	gdk_cursor_new_from_pixmap 
- * Choice of colorscheme
- * User defined colorscheme
- * Save file dialog 
  * Reset confirmation
  * Expand window instead of reallocate space.
  * Real anti-alisaing via multisampling (also downsampling)
@@ -20,18 +14,21 @@ package main
 import (
 	"fmt"
 	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/gdkpixbuf"
 	"github.com/mattn/go-gtk/glib"
 	"github.com/mattn/go-gtk/gtk"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"image"
 	"image/color"
-	"image/png"
 	"saph/graphic"
 	"saph/fractal"
 	"saph/graphic/palette"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"unsafe"
 )
@@ -51,19 +48,59 @@ var drawingarea *gtk.DrawingArea
 var pixmap *gdk.Pixmap
 var gc *gdk.GC
 var pixChan chan graphic.Pixel
+var settings fractal.Settings
 
 var frac *fractal.Fractal
 var imageSize graphic.Box
+var palettes *palette.Registry
 
 var maxIterationsEntry *gtk.Entry
 var bailoutRadiusEntry *gtk.Entry
 var normalizeCheckbutton *gtk.CheckButton
 var multisampleComboBoxText *gtk.ComboBoxText
+var paletteComboBoxText *gtk.ComboBoxText
 var colorFrequencyEntry *gtk.Entry
+var setColorComboBoxText *gtk.ComboBoxText
+var paletteComboSize, setColorComboSize int // entries added to the combo boxes
+
+// loadedName names palettes and colors of opened files that are not
+// registered.
+const loadedName = "Loaded"
+
+var decompositionComboBoxText *gtk.ComboBoxText
+var fieldLinesCheckbutton *gtk.CheckButton
+var shadingCheckbutton *gtk.CheckButton
+var glowCheckbutton *gtk.CheckButton
+var orbitTrapCheckbutton *gtk.CheckButton
 var progressBar *gtk.ProgressBar
 
 var before time.Time
 
+const (
+	cycleInterval = 40    // milliseconds between color cycling frames
+	cycleStep     = 0.005 // palette turns per color cycling frame
+	cycleFrames   = 200   // frames of an exported color cycle
+)
+
+const (
+	glowWidth      = 4   // pixels
+	orbitTrapWidth = 0.5 // distance from the trap where its color fades out
+)
+
+const posterScale = 8 // default poster size, in multiples of the window
+
+const (
+	clickZoom  = 10   // magnification of a click
+	scrollZoom = 1.25 // magnification of a scroll wheel step
+)
+
+var orbitTrapPoint = complex(0, 0)
+
+var cycleMenuItem *gtk.CheckMenuItem
+
+var backMenuItem, forwardMenuItem *gtk.MenuItem
+var colorOffset float64
+
 var cursor int
 
 func main() {
@@ -81,12 +118,21 @@ func main() {
 	//frac = fractal.NewJulia(complex(-0.7, 0.3))
 	frac = fractal.NewMandelbrot()
 
+	palettes = palette.NewRegistry()
+	if err := palettes.LoadDir(paletteDir()); err != nil {
+		log.Println(err)
+	}
+
 	 // Layout
 	vbox1 := gtk.NewVBox(false, 5)
 	vbox1.SetBorderWidth(5)
 		
-		frame11 := gtk.NewFrame("Left click - zoom in, right click - zoom out")
-		vbox1.PackStart(frame11, true, true, 0)
+		hbox11 := gtk.NewHBox(false, 5)
+		vbox1.PackStart(hbox11, true, true, 0)
+
+		frame11 := gtk.NewFrame("Left click or drag - zoom in, right click - zoom out, scroll - zoom at the pointer, ctrl+scroll - box size, middle or shift+drag - pan")
+		hbox11.PackStart(frame11, true, true, 0)
+		hbox11.PackStart(newBookmarkPanel(), false, false, 0)
 		
 		hbox12f := gtk.NewHBox(false, 0)
 		vbox1.PackStart(hbox12f, false, false, 0)
@@ -163,42 +209,153 @@ func main() {
 	})
 	submenu.Append(menuitem)
 */
-/*	menuitem = gtk.NewMenuItemWithMnemonic("_Save image")
+	menuitem = gtk.NewMenuItemWithMnemonic("_Open image...")
 	menuitem.Connect("activate", func() {
-		if isRendering {
+		if !frac.IsFinished() {
 			return
 		}
-		renderLock()
-	
-		temp := imageSize
-		imageSize = graphic.Box{1920, 1200}
-		
-		go func() {
-			img := image.NewRGBA(image.Rect(0, 0, 1920, 1200))
-			render()
+		filename, ok := chooseFile("Open image", gtk.FILE_CHOOSER_ACTION_OPEN, "", "*.png")
+		if ok {
+			openImage(filename)
+		}
+	})
+	submenu.Append(menuitem)
 
-			for c := range pixChan {
-				color := color.RGBA{c.R, c.G, c.B, c.A}
-				img.Set(c.X, c.Y, color)
-			}
+	menuitem = gtk.NewMenuItemWithMnemonic("_Save image...")
+	menuitem.Connect("activate", func() {
+		if !frac.IsFinished() {
+			return
+		}
+		filename, ok := chooseFile("Save image", gtk.FILE_CHOOSER_ACTION_SAVE, "fractal.png", "*.png")
+		if ok {
+			saveImage(filename)
+		}
+	})
+	submenu.Append(menuitem)
 
-			err := CreatePng("mandel111", img)
-			if err != nil {
-				log.Println(err)
-			}
+	menuitem = gtk.NewMenuItemWithMnemonic("Save _HDR image...")
+	menuitem.Connect("activate", func() {
+		if !frac.IsFinished() {
+			return
+		}
+		filename, ok := chooseFile("Save HDR image", gtk.FILE_CHOOSER_ACTION_SAVE, "fractal.png", "*.png", "*.pfm")
+		if ok {
+			saveHDRImage(filename)
+		}
+	})
+	submenu.Append(menuitem)
 
-			imageSize = temp
-			renderUnlock()
-		}()
+	menuitem = gtk.NewMenuItemWithMnemonic("Save p_oster...")
+	menuitem.Connect("activate", func() {
+		if !frac.IsFinished() {
+			return
+		}
+		poster, ok := askPoster()
+		if !ok {
+			return
+		}
+		filename, ok := chooseFile("Save poster", gtk.FILE_CHOOSER_ACTION_SAVE, "poster.png", "*.png")
+		if ok {
+			savePoster(filename, poster)
+		}
 	})
 	submenu.Append(menuitem)
-*/
+
+	menuitem = gtk.NewMenuItemWithMnemonic("Open _parameters...")
+	menuitem.Connect("activate", func() {
+		if !frac.IsFinished() {
+			return
+		}
+		filename, ok := chooseFile("Open parameters", gtk.FILE_CHOOSER_ACTION_OPEN, "", "*.json")
+		if ok {
+			openParams(filename)
+		}
+	})
+	submenu.Append(menuitem)
+
+	menuitem = gtk.NewMenuItemWithMnemonic("Save p_arameters...")
+	menuitem.Connect("activate", func() {
+		filename, ok := chooseFile("Save parameters", gtk.FILE_CHOOSER_ACTION_SAVE, "fractal.json", "*.json")
+		if ok {
+			saveParams(filename)
+		}
+	})
+	submenu.Append(menuitem)
+
+	menuitem = gtk.NewMenuItemWithMnemonic("Edit _palette...")
+	menuitem.Connect("activate", func() {
+		showPaletteEditor()
+	})
+	submenu.Append(menuitem)
+
+	menuitem = gtk.NewMenuItemWithMnemonic("Edit _lighting...")
+	menuitem.Connect("activate", func() {
+		if !frac.IsFinished() {
+			return
+		}
+		editLighting()
+	})
+	submenu.Append(menuitem)
+
+	cycleMenuItem = gtk.NewCheckMenuItemWithMnemonic("_Cycle colors")
+	cycleMenuItem.Connect("toggled", func() {
+		if cycleMenuItem.GetActive() {
+			glib.TimeoutAdd(cycleInterval, cycleColors)
+		}
+	})
+	submenu.Append(cycleMenuItem)
+
+	menuitem = gtk.NewMenuItemWithMnemonic("Export color c_ycle...")
+	menuitem.Connect("activate", func() {
+		name, ok := chooseFile("Export color cycle", gtk.FILE_CHOOSER_ACTION_SAVE, "cycle.gif", "*.gif", "*.png", "*")
+		if ok {
+			exportCycle(name)
+		}
+	})
+	submenu.Append(menuitem)
+
 	menuitem = gtk.NewMenuItemWithMnemonic("E_xit")
 	menuitem.Connect("activate", func() {
 		gtk.MainQuit()
 	})
 	submenu.Append(menuitem)
 
+	cascademenu = gtk.NewMenuItemWithMnemonic("_Go")
+	menubar.Append(cascademenu)
+	submenu = gtk.NewMenu()
+	cascademenu.SetSubmenu(submenu)
+
+	backMenuItem = gtk.NewMenuItemWithMnemonic("_Back")
+	backMenuItem.Connect("activate", func() {
+		renders.back()
+	})
+	submenu.Append(backMenuItem)
+
+	forwardMenuItem = gtk.NewMenuItemWithMnemonic("_Forward")
+	forwardMenuItem.Connect("activate", func() {
+		renders.forward()
+	})
+	submenu.Append(forwardMenuItem)
+	updateHistoryMenu()
+
+	submenu.Append(gtk.NewSeparatorMenuItem())
+
+	menuitem = gtk.NewMenuItemWithMnemonic("Add _bookmark...")
+	menuitem.Connect("activate", func() {
+		if !frac.IsFinished() {
+			return
+		}
+		name, ok := askBookmark()
+		if !ok {
+			return
+		}
+		if err := addBookmark(name); err != nil {
+			showError(err)
+		}
+		updateBookmarkPanel()
+	})
+	submenu.Append(menuitem)
+
 
 	//~~~~~~~~~~~~ DrawingArea - Fractal ~~~~~~~~~~~~
 	drawingarea = gtk.NewDrawingArea()
@@ -219,20 +376,91 @@ func main() {
 
 	drawingarea.Connect("expose-event", func() {
 		if pixmap != nil {
-			drawingarea.GetWindow().GetDrawable().DrawDrawable(gc, pixmap.GetDrawable(), 0, 0, 0, 0, -1, -1)
+			drawable := drawingarea.GetWindow().GetDrawable()
+			if pan.active {
+				pan.draw(drawable)
+				return
+			}
+			drawable.DrawDrawable(gc, pixmap.GetDrawable(), 0, 0, 0, 0, -1, -1)
+			zoomBox.draw(drawable)
 		}
 	})
 
 	drawingarea.Connect("button-press-event", func(ctx *glib.CallbackContext) {
-		var x, y int
-		var mt gdk.ModifierType
-		drawingarea.GetWindow().GetPointer(&x, &y, &mt)
-		magnifySize := graphic.Box{imageSize.Width/10, imageSize.Height/10}
-		frac.Magnify(imageSize, magnifySize, image.Point{x,y})
-		render()		
+		event := (*gdk.EventButton)(unsafe.Pointer(ctx.Args(0)))
+		point := image.Point{int(event.X), int(event.Y)}
+		shift := gdk.ModifierType(event.State)&gdk.SHIFT_MASK != 0
+		switch {
+		case event.Button == 2 || event.Button == 1 && shift:
+			pan.begin(point)
+		case event.Button == 1:
+			zoomBox.dragging, zoomBox.start, zoomBox.pointer = true, point, point
+		case event.Button == 3:
+			zoomOut(point)
+		case event.Button == 8:
+			renders.back()
+		case event.Button == 9:
+			renders.forward()
+		}
 	})
 
-	drawingarea.SetEvents(int(gdk.BUTTON_PRESS_MASK))
+	// A click zooms into the box around the pointer, a drag into the
+	// selected region.
+	drawingarea.Connect("button-release-event", func(ctx *glib.CallbackContext) {
+		event := (*gdk.EventButton)(unsafe.Pointer(ctx.Args(0)))
+		point := image.Point{int(event.X), int(event.Y)}
+		if pan.active {
+			pan.end(point)
+			return
+		}
+		if event.Button != 1 || !zoomBox.dragging {
+			return
+		}
+		zoomBox.pointer = point
+		r := zoomBox.rect()
+		zoomBox.dragging = false
+		zoomIn(r)
+	})
+
+	drawingarea.Connect("motion-notify-event", func(ctx *glib.CallbackContext) {
+		event := (*gdk.EventMotion)(unsafe.Pointer(ctx.Args(0)))
+		zoomBox.pointer = image.Point{int(event.X), int(event.Y)}
+		zoomBox.inside = true
+		if pan.active {
+			pan.move(zoomBox.pointer)
+			return
+		}
+		drawingarea.GetWindow().Invalidate(nil, false)
+	})
+
+	drawingarea.Connect("leave-notify-event", func() {
+		zoomBox.inside = false
+		drawingarea.GetWindow().Invalidate(nil, false)
+	})
+
+	// Scrolling keeps the point under the pointer in place.
+	drawingarea.Connect("scroll-event", func(ctx *glib.CallbackContext) {
+		event := (*gdk.EventScroll)(unsafe.Pointer(ctx.Args(0)))
+		var factor float64
+		switch event.Direction {
+		case gdk.SCROLL_UP:
+			factor = scrollZoom
+		case gdk.SCROLL_DOWN:
+			factor = 1 / scrollZoom
+		default:
+			return
+		}
+		if gdk.ModifierType(event.State)&gdk.CONTROL_MASK != 0 {
+			zoomBox.resize(factor > 1)
+			drawingarea.GetWindow().Invalidate(nil, false)
+			return
+		}
+		frac.ZoomAt(imageSize, event.X, event.Y, factor)
+		render()
+	})
+
+	drawingarea.SetEvents(int(gdk.BUTTON_PRESS_MASK | gdk.BUTTON_RELEASE_MASK | gdk.POINTER_MOTION_MASK |
+		gdk.LEAVE_NOTIFY_MASK | gdk.SCROLL_MASK))
 	frame11.Add(drawingarea)
 
 	//~~~~~~~~~~~~ Entry - Max iterations ~~~~~~~~~~~~
@@ -283,12 +511,10 @@ func main() {
 	vbox1213.PackStart(NewLeftAlignedLabel("Normalize:"), true, true, 0)
 	vbox1214.PackStart(normalizeCheckbutton, true, true, 0)
 	
-	paletteCombobox := gtk.NewComboBoxText()
-	paletteCombobox.AppendText("Peach")
-	paletteCombobox.AppendText("Banana")
-	paletteCombobox.AppendText("Apple")
+	//~~~~~~~~~~~~ ComboBoxText - Palette ~~~~~~~~~~~~
+	paletteComboBoxText = gtk.NewComboBoxText()
 	vbox1221.PackStart(NewLeftAlignedLabel("Palette:"), true, true, 0)
-	vbox1222.PackStart(paletteCombobox, true, true, 0)
+	vbox1222.PackStart(paletteComboBoxText, true, true, 0)
 
 	//~~~~~~~~~~~~ Entry - Color frequency ~~~~~~~~~~~~
 	colorFrequencyEntry = gtk.NewEntry()
@@ -303,19 +529,49 @@ func main() {
 	})
 	vbox1221.PackStart(NewLeftAlignedLabel("Frequency:"), true, true, 0)
 	vbox1222.PackStart(colorFrequencyEntry, true, true, 0)
+
+	//~~~~~~~~~~~~ CheckButton - Field lines ~~~~~~~~~~~~
+	fieldLinesCheckbutton = gtk.NewCheckButton()
+	fieldLinesCheckbutton.SetActive(false)
+	vbox1221.PackStart(NewLeftAlignedLabel("Field lines:"), true, true, 0)
+	vbox1222.PackStart(fieldLinesCheckbutton, true, true, 0)
 	
 	
-	setColorCombobox := gtk.NewComboBoxText()
-	setColorCombobox.AppendText("Peach")
-	setColorCombobox.AppendText("Banana")
-	setColorCombobox.AppendText("Apple")
+	//~~~~~~~~~~~~ ComboBoxText - Set color ~~~~~~~~~~~~
+	setColorComboBoxText = gtk.NewComboBoxText()
+	syncComboBoxes()
+	paletteComboBoxText.SetActive(0)
+	setColorComboBoxText.SetActive(0)
 	vbox1223.PackStart(NewLeftAlignedLabel("Set color:"), true, true, 0)
-	vbox1224.PackStart(setColorCombobox, true, true, 0)
+	vbox1224.PackStart(setColorComboBoxText, true, true, 0)
 	
-	dummyL := gtk.NewLabel("")
-	dummyR := gtk.NewLabel("")
-	vbox1223.PackStart(dummyL, true, true, 0)
-	vbox1224.PackStart(dummyR, true, true, 0)
+	//~~~~~~~~~~~~ ComboBoxText - Decomposition ~~~~~~~~~~~~
+	decompositionComboBoxText = gtk.NewComboBoxText()
+	decompositionComboBoxText.AppendText("None")
+	decompositionComboBoxText.AppendText("Binary")
+	decompositionComboBoxText.AppendText("Angle")
+	decompositionComboBoxText.AppendText("Binary + angle")
+	decompositionComboBoxText.SetActive(0)
+	vbox1223.PackStart(NewLeftAlignedLabel("Decomposition:"), true, true, 0)
+	vbox1224.PackStart(decompositionComboBoxText, true, true, 0)
+
+	//~~~~~~~~~~~~ CheckButton - Shading ~~~~~~~~~~~~
+	shadingCheckbutton = gtk.NewCheckButton()
+	shadingCheckbutton.SetActive(false)
+	vbox1223.PackStart(NewLeftAlignedLabel("Shading:"), true, true, 0)
+	vbox1224.PackStart(shadingCheckbutton, true, true, 0)
+
+	//~~~~~~~~~~~~ CheckButton - Glow ~~~~~~~~~~~~
+	glowCheckbutton = gtk.NewCheckButton()
+	glowCheckbutton.SetActive(false)
+	vbox1221.PackStart(NewLeftAlignedLabel("Glow:"), true, true, 0)
+	vbox1222.PackStart(glowCheckbutton, true, true, 0)
+
+	//~~~~~~~~~~~~ CheckButton - Orbit trap ~~~~~~~~~~~~
+	orbitTrapCheckbutton = gtk.NewCheckButton()
+	orbitTrapCheckbutton.SetActive(false)
+	vbox1223.PackStart(NewLeftAlignedLabel("Orbit trap:"), true, true, 0)
+	vbox1224.PackStart(orbitTrapCheckbutton, true, true, 0)
 
 	//~~~~~~~~~~~~ Button - Render ~~~~~~~~~~~~
 	button := gtk.NewButtonWithLabel("               Render               ")
@@ -329,17 +585,31 @@ func main() {
 	progressBar.SetText("0%")
 	hbox13.PackStart(progressBar, true, true, 0)
 
+	trackEdits()
+
 	window.Add(vbox1)
 	defaultSizeRequest()
 	window.ShowAll()
 	gtk.Main()
 }
 
+// paletteDir is the directory user palettes are loaded from.
+func paletteDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = os.Getenv("HOME")
+	}
+	return filepath.Join(dir, "fractalExplorer", "palettes")
+}
+
 func defaultSizeRequest() {
 	window.SetSizeRequest(1000, 700)
 }
 
 func entryInsertIsInt(ctx *glib.CallbackContext) bool {
+	if mirroring {
+		return true
+	}
 	a := (*[2000]uint8)(unsafe.Pointer(ctx.Args(0)))
 	i := 0
 	for a[i] != 0 {
@@ -363,16 +633,21 @@ func NewLeftAlignedLabel(labelText string) gtk.IWidget {
 }
 
 
+// render renders the current fractal with the current settings, changed
+// by the widgets edited since the latest render.
 func render() {
 	renderLock()
-	maxIterations, _ := strconv.Atoi(maxIterationsEntry.GetText())
-	bailoutRadius, _ := strconv.ParseFloat(bailoutRadiusEntry.GetText(), 64)
-	normalize := normalizeCheckbutton.GetActive()
-	sampleRatio := 4 - multisampleComboBoxText.GetActive() // OBS 0
-	colorScheme := palette.CyclicPalette([]color.RGBA{palette.Orange, palette.White, palette.OrangeRed, palette.Red})
-	colorFrequency, _ := strconv.ParseFloat(colorFrequencyEntry.GetText(), 64)
-	setColor := palette.Black
-	pixChan = frac.Render(imageSize, maxIterations, bailoutRadius, normalize,	sampleRatio, setColor, colorScheme, colorFrequency)
+	s := applyEdits(settings)
+	// Keep the pixels square whatever the shape of the window.
+	frac.SetViewport(frac.Viewport().Fit(imageSize))
+	var err error
+	if pixChan, err = frac.Render(imageSize, s); err != nil {
+		renderUnlock()
+		showError(err)
+		return
+	}
+	settings = s
+	edits = make(map[interface{}]bool)
 	before = time.Now()
 	glib.IdleAdd(printPixChan)
 }
@@ -396,9 +671,7 @@ func renderUnlock() {
 func printPixChan() bool {
 	defer drawingarea.GetWindow().Invalidate(nil, false)
 	defer func(){
-		progress := frac.GetProgress()
-		progressBar.SetFraction(progress)
-		progressBar.SetText(fmt.Sprintf("%d%%", int(progress*100)))
+		setProgress(frac.GetProgress())
 	}()
 	timeout := time.After(time.Millisecond*100)
 	for {
@@ -409,6 +682,8 @@ func printPixChan() bool {
 			if !ok {
 				renderUnlock()
 				log.Println("Time: ", time.Now().Sub(before))
+				renders.remember()
+				updateHistoryMenu()
 				return false
 			}
 			// EXPENSIVE NON ALLOCATED!!!!!!!
@@ -420,12 +695,426 @@ func printPixChan() bool {
 	return false
 }
 
-func CreatePng(filename string, img image.Image) (err error) {
-	file, err := os.Create(filename + ".png")
+func setProgress(progress float64) {
+	progressBar.SetFraction(progress)
+	progressBar.SetText(fmt.Sprintf("%d%%", int(progress*100)))
+}
+
+// runInBackground runs work in a goroutine with the window locked, showing
+// the progress it reports until it is done.
+func runInBackground(work func(report func(progress float64)) error) {
+	renderLock()
+	var mutex sync.Mutex
+	var progress float64
+	report := func(p float64) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		progress = p
+	}
+	done := make(chan error, 1)
+	go func() { done <- work(report) }()
+	glib.IdleAdd(func() bool {
+		select {
+		case err := <-done:
+			setProgress(1)
+			renderUnlock()
+			if err != nil {
+				showError(err)
+			}
+			return false
+		case <-time.After(time.Millisecond * 100):
+			mutex.Lock()
+			defer mutex.Unlock()
+			setProgress(progress)
+			return true
+		}
+	})
+}
+
+// cycleColors shows the next frame of the color cycling. It returns false
+// to stop the timer once cycling is turned off.
+func cycleColors() bool {
+	if !cycleMenuItem.GetActive() {
+		return false
+	}
+	colorOffset += cycleStep
+	settings.ColorOffset = colorOffset
+	recolor(settings)
+	return true
+}
+
+// exportCycle writes a whole turn of color cycling as an animation, see
+// graphic.CreateFrameWriter.
+func exportCycle(name string) {
+	buffer := frac.Buffer()
+	if buffer == nil || !frac.IsFinished() {
+		return
+	}
+	s := settings
+	runInBackground(func(report func(float64)) error {
+		w, err := graphic.CreateFrameWriter(name, cycleFrames, cycleInterval*time.Millisecond, 0, s.QuantizationPalette(256))
+		if err != nil {
+			return err
+		}
+		err = buffer.Cycle(s, cycleFrames, func(i int, img *image.RGBA) error {
+			report(float64(i+1) / cycleFrames)
+			return w.WriteFrame(img)
+		})
+		if err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// recolor redraws the latest render from its samples with the color
+// settings of s.
+func recolor(s fractal.Settings) {
+	buffer := frac.Buffer()
+	if buffer == nil || !frac.IsFinished() || buffer.Box != imageSize {
+		return
+	}
+	drawImage(buffer.Image(s))
+}
+
+// withPalette returns s with the palette of its palette layers replaced.
+func withPalette(s fractal.Settings, p palette.Palette) fractal.Settings {
+	s.Layers = append([]fractal.Layer(nil), s.Layers...)
+	for i := range s.Layers {
+		if s.Layers[i].Kind == fractal.PaletteLayer {
+			s.Layers[i].Palette = p
+		}
+	}
+	return s
+}
+
+// drawImage copies img onto the pixmap in one go.
+func drawImage(img *image.RGBA) {
+	drawRGBA(pixmap.GetDrawable(), gc, img, 0, 0)
+	drawingarea.GetWindow().Invalidate(nil, false)
+}
+
+// drawRGBA draws img onto drawable with its top left corner at x, y.
+func drawRGBA(drawable *gdk.Drawable, gc *gdk.GC, img *image.RGBA, x, y int) {
+	b := img.Bounds()
+	pixbuf := gdkpixbuf.NewPixbuf(gdkpixbuf.GDK_COLORSPACE_RGB, true, 8, b.Dx(), b.Dy())
+	defer pixbuf.Unref()
+	pixels := pixbuf.GetPixels()
+	stride := pixbuf.GetRowstride()
+	for row := 0; row < b.Dy(); row++ {
+		copy(pixels[row*stride:row*stride+4*b.Dx()], img.Pix[row*img.Stride:])
+	}
+	drawable.DrawPixbuf(gc, pixbuf, 0, 0, x, y, b.Dx(), b.Dy(), gdk.RGB_DITHER_NONE, 0, 0)
+}
+
+// chooseFile asks for a file name with a file chooser dialog. The patterns
+// filter the files shown; name is suggested when saving.
+func chooseFile(title string, action gtk.FileChooserAction, name string, patterns ...string) (string, bool) {
+	button := gtk.STOCK_OPEN
+	if action == gtk.FILE_CHOOSER_ACTION_SAVE {
+		button = gtk.STOCK_SAVE
+	}
+	dialog := gtk.NewFileChooserDialog(title, window, action,
+		gtk.STOCK_CANCEL, gtk.RESPONSE_CANCEL, button, gtk.RESPONSE_ACCEPT)
+	defer dialog.Destroy()
+	if len(patterns) > 0 {
+		filter := gtk.NewFileFilter()
+		for _, pattern := range patterns {
+			filter.AddPattern(pattern)
+		}
+		dialog.AddFilter(filter)
+	}
+	if action == gtk.FILE_CHOOSER_ACTION_SAVE {
+		dialog.SetDoOverwriteConfirmation(true)
+		dialog.SetCurrentName(name)
+	}
+	if dialog.Run() != gtk.RESPONSE_ACCEPT {
+		return "", false
+	}
+	return dialog.GetFilename(), true
+}
+
+// showError reports an error in a message dialog.
+func showError(err error) {
+	log.Println(err)
+	dialog := gtk.NewMessageDialog(window, gtk.DIALOG_MODAL, gtk.MESSAGE_ERROR, gtk.BUTTONS_CLOSE, "%s", err.Error())
+	dialog.Run()
+	dialog.Destroy()
+}
+
+// saveImage writes the current image to a PNG file that remembers where
+// it was rendered and how it was colored.
+func saveImage(filename string) {
+	buffer := frac.Buffer()
+	if buffer == nil {
+		return
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		showError(err)
+		return
+	}
+	defer file.Close()
+	if err := frac.EncodePNG(file, buffer.Image(settings), settings); err != nil {
+		showError(err)
+	}
+}
+
+// saveHDRImage writes the current image as a 16-bit PNG, or as a float
+// PFM if the file name ends in .pfm.
+func saveHDRImage(filename string) {
+	buffer := frac.Buffer()
+	if buffer == nil {
+		return
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		showError(err)
+		return
+	}
+	defer file.Close()
+	if strings.EqualFold(filepath.Ext(filename), ".pfm") {
+		err = graphic.WritePFM(file, buffer.FloatImage(settings))
+	} else {
+		err = frac.EncodePNG(file, buffer.Image64(settings), settings)
+	}
+	if err != nil {
+		showError(err)
+	}
+}
+
+// askPoster asks for the size and depth of a poster.
+func askPoster() (fractal.Poster, bool) {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Save poster")
+	dialog.SetTransientFor(window)
+	defer dialog.Destroy()
+
+	widthEntry := gtk.NewEntry()
+	widthEntry.SetText(strconv.Itoa(posterScale * imageSize.Width))
+	heightEntry := gtk.NewEntry()
+	heightEntry.SetText(strconv.Itoa(posterScale * imageSize.Height))
+	deepCheckbutton := gtk.NewCheckButtonWithLabel("16 bits per channel")
+	hbox := gtk.NewHBox(false, 5)
+	hbox.PackStart(gtk.NewLabel("Size"), false, false, 0)
+	hbox.PackStart(widthEntry, true, true, 0)
+	hbox.PackStart(gtk.NewLabel("x"), false, false, 0)
+	hbox.PackStart(heightEntry, true, true, 0)
+	dialog.GetVBox().PackStart(hbox, false, false, 5)
+	dialog.GetVBox().PackStart(deepCheckbutton, false, false, 5)
+	dialog.AddButton(gtk.STOCK_CANCEL, gtk.RESPONSE_CANCEL)
+	dialog.AddButton(gtk.STOCK_OK, gtk.RESPONSE_OK)
+	dialog.ShowAll()
+	if dialog.Run() != gtk.RESPONSE_OK {
+		return fractal.Poster{}, false
+	}
+
+	width, err1 := strconv.Atoi(widthEntry.GetText())
+	height, err2 := strconv.Atoi(heightEntry.GetText())
+	if err1 != nil || err2 != nil || width < 1 || height < 1 {
+		showError(fmt.Errorf("invalid poster size %sx%s", widthEntry.GetText(), heightEntry.GetText()))
+		return fractal.Poster{}, false
+	}
+	poster := fractal.Poster{
+		Box:  graphic.Box{Width: width, Height: height},
+		Deep: deepCheckbutton.GetActive(),
+	}
+	return poster, true
+}
+
+// savePoster renders a poster into a PNG file in the background. A poster
+// that was interrupted resumes when it is saved to the same file again.
+func savePoster(filename string, poster fractal.Poster) {
+	// The view of the window, fitted to the shape of the poster.
+	fr := newFractal(frac.IsMandelbrot(), frac.JuliaConstant(), frac.Viewport().Fit(poster.Box))
+	s := settings
+	runInBackground(func(report func(float64)) error {
+		file, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		poster.Progress = report
+		poster.Checkpoint = filename + ".checkpoint"
+		if err := fr.EncodePoster(file, poster, s); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	})
+}
+
+// newFractal returns the Mandelbrot set, or the Julia set of c, seen
+// through the view v.
+func newFractal(isMandelbrot bool, c complex128, v fractal.Viewport) *fractal.Fractal {
+	fr := fractal.NewMandelbrot()
+	if !isMandelbrot {
+		fr = fractal.NewJulia(c)
+	}
+	fr.SetViewport(v)
+	return fr
+}
+
+// openImage restores the fractal and settings of a PNG saved by saveImage
+// and renders it again.
+func openImage(filename string) {
+	file, err := os.Open(filename)
+	if err != nil {
+		showError(err)
+		return
+	}
+	defer file.Close()
+	fr, s, _, err := fractal.DecodePNG(file)
+	if err != nil {
+		showError(fmt.Errorf("%s: %v", filename, err))
+		return
+	}
+	load(fr, s)
+}
+
+// saveParams writes the current fractal and settings to a parameter file.
+func saveParams(filename string) {
+	file, err := os.Create(filename)
+	if err != nil {
+		showError(err)
+		return
+	}
+	defer file.Close()
+	if err := frac.SaveParams(file, settings); err != nil {
+		showError(err)
+	}
+}
+
+// openParams renders the fractal of a parameter file.
+func openParams(filename string) {
+	file, err := os.Open(filename)
 	if err != nil {
-		log.Fatalf("CreatePng: %s", err)
+		showError(err)
+		return
 	}
 	defer file.Close()
-	err = png.Encode(file, img)
-	return
+	fr, s, err := fractal.LoadParams(file)
+	if err != nil {
+		showError(fmt.Errorf("%s: %v", filename, err))
+		return
+	}
+	load(fr, s)
+}
+
+// load makes fr and s the current fractal and settings and renders them.
+// The widgets only show s; those edited later change it.
+func load(fr *fractal.Fractal, s fractal.Settings) {
+	frac = fr
+	settings = s
+	mirror(func() { setWidgets(s) })
+	edits = make(map[interface{}]bool)
+	render()
+}
+
+// setWidgets shows the settings s in the settings widgets. Palettes and
+// colors that are not registered are added as "Loaded".
+func setWidgets(s fractal.Settings) {
+	// Sample ratios above 4 show as x4.
+	row := 4 - s.SampleRatio
+	if row < 0 {
+		row = 0
+	}
+	maxIterationsEntry.SetText(strconv.Itoa(s.MaxIterations))
+	bailoutRadiusEntry.SetText(strconv.FormatFloat(s.BailoutRadius, 'g', -1, 64))
+	normalizeCheckbutton.SetActive(s.Normalize)
+	multisampleComboBoxText.SetActive(row)
+	colorFrequencyEntry.SetText(strconv.FormatFloat(s.ColorFrequency, 'g', -1, 64))
+	colorOffset = s.ColorOffset
+
+	switch s.Decomposition &^ fractal.FieldLines {
+	case fractal.BinaryDecomposition:
+		decompositionComboBoxText.SetActive(1)
+	case fractal.AngleDecomposition:
+		decompositionComboBoxText.SetActive(2)
+	case fractal.BinaryDecomposition | fractal.AngleDecomposition:
+		decompositionComboBoxText.SetActive(3)
+	default:
+		decompositionComboBoxText.SetActive(0)
+	}
+	fieldLinesCheckbutton.SetActive(s.Decomposition&fractal.FieldLines != 0)
+
+	glowCheckbutton.SetActive(false)
+	orbitTrapCheckbutton.SetActive(false)
+	shadingCheckbutton.SetActive(false)
+	for _, l := range s.Layers {
+		switch l.Kind {
+		case fractal.PaletteLayer:
+			selectPalette(l.Palette)
+			selectSetColor(l.SetColor)
+		case fractal.GlowLayer:
+			glowCheckbutton.SetActive(true)
+		case fractal.OrbitTrapLayer:
+			orbitTrapCheckbutton.SetActive(true)
+			orbitTrapPoint = l.Trap
+		case fractal.SlopeLayer:
+			shadingCheckbutton.SetActive(true)
+			lighting = l.Lighting
+		}
+	}
+}
+
+// selectPalette selects p in the Palette combo box, registering it if needed.
+func selectPalette(p palette.Palette) {
+	for _, name := range palettes.PaletteNames() {
+		if q, _ := palettes.Palette(name); samePalette(p, q) {
+			setActiveName(paletteComboBoxText, palettes.PaletteNames(), name)
+			return
+		}
+	}
+	palettes.AddPalette(loadedName, p)
+	syncComboBoxes()
+	setActiveName(paletteComboBoxText, palettes.PaletteNames(), loadedName)
+}
+
+// selectSetColor selects c in the Set color combo box, registering it if needed.
+func selectSetColor(c color.RGBA) {
+	for _, name := range palettes.ColorNames() {
+		if d, _ := palettes.Color(name); c == d {
+			setActiveName(setColorComboBoxText, palettes.ColorNames(), name)
+			return
+		}
+	}
+	palettes.AddColor(loadedName, c)
+	syncComboBoxes()
+	setActiveName(setColorComboBoxText, palettes.ColorNames(), loadedName)
+}
+
+func samePalette(p, q palette.Palette) bool {
+	if len(p) != len(q) {
+		return false
+	}
+	for i := range p {
+		if p[i] != q[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// syncComboBoxes adds the palettes and colors registered since the
+// Palette and Set color combo boxes were last filled.
+func syncComboBoxes() {
+	names := palettes.PaletteNames()
+	for ; paletteComboSize < len(names); paletteComboSize++ {
+		paletteComboBoxText.AppendText(names[paletteComboSize])
+	}
+	names = palettes.ColorNames()
+	for ; setColorComboSize < len(names); setColorComboSize++ {
+		setColorComboBoxText.AppendText(names[setColorComboSize])
+	}
+}
+
+// setActiveName selects the entry name of a combo box filled with names.
+func setActiveName(combo *gtk.ComboBoxText, names []string, name string) {
+	for i, n := range names {
+		if n == name {
+			combo.SetActive(i)
+			return
+		}
+	}
 }
@@ -0,0 +1,88 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"reflect"
+	"saph/fractal"
+)
+
+const historySize = 100 // renders remembered for going back
+
+// historyEntry is a finished render: the fractal, its view and the
+// settings it was rendered with.
+type historyEntry struct {
+	isMandelbrot  bool
+	juliaConstant complex128
+	view          fractal.Viewport
+	settings      fractal.Settings
+}
+
+// fractal returns the fractal of the entry and its settings.
+func (e historyEntry) fractal() (*fractal.Fractal, fractal.Settings) {
+	return newFractal(e.isMandelbrot, e.juliaConstant, e.view), e.settings
+}
+
+// history is the list of finished renders and the position of the current
+// one in it.
+type history struct {
+	entries   []historyEntry
+	pos       int
+	restoring bool // the render in progress goes back or forward
+}
+
+var renders = &history{pos: -1}
+
+// remember adds the render that just finished, dropping the renders that
+// were gone back from.
+func (h *history) remember() {
+	if h.restoring {
+		h.restoring = false
+		return
+	}
+	e := historyEntry{
+		isMandelbrot:  frac.IsMandelbrot(),
+		juliaConstant: frac.JuliaConstant(),
+		view:          frac.Viewport(),
+		settings:      settings,
+	}
+	if h.pos >= 0 && reflect.DeepEqual(h.entries[h.pos], e) {
+		return
+	}
+	h.entries = append(h.entries[:h.pos+1], e)
+	if len(h.entries) > historySize {
+		h.entries = h.entries[1:]
+	}
+	h.pos = len(h.entries) - 1
+}
+
+func (h *history) canGoBack() bool    { return h.pos > 0 }
+func (h *history) canGoForward() bool { return h.pos < len(h.entries)-1 }
+
+func (h *history) back() {
+	if h.canGoBack() {
+		h.restore(h.pos - 1)
+	}
+}
+
+func (h *history) forward() {
+	if h.canGoForward() {
+		h.restore(h.pos + 1)
+	}
+}
+
+// restore renders entry i again.
+func (h *history) restore(i int) {
+	load(h.entries[i].fractal())
+	// The render finishes later, and is not remembered again.
+	h.pos = i
+	h.restoring = true
+}
+
+// updateHistoryMenu enables the Back and Forward menu items when there is
+// somewhere to go.
+func updateHistoryMenu() {
+	backMenuItem.SetSensitive(renders.canGoBack())
+	forwardMenuItem.SetSensitive(renders.canGoForward())
+}
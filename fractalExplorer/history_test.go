@@ -0,0 +1,53 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"image/color"
+	"reflect"
+	"saph/fractal"
+	"saph/graphic/palette"
+	"testing"
+)
+
+// Going back renders an entry with exactly the settings it was rendered
+// with, including those the widgets cannot show.
+func TestRestoreKeepsSettings(t *testing.T) {
+	glow := fractal.NewGlowLayer(palette.Red, 7)
+	glow.Opacity = 0.4
+	trap := fractal.NewOrbitTrapLayer(palette.Palette{palette.Blue, palette.White}, complex(0.2, -0.1), 0.3)
+	trap.Blend, trap.Mask = fractal.Overlay, fractal.InsideMask
+	light := fractal.DefaultLighting
+	light.Ambient = 0.35
+	e := historyEntry{
+		juliaConstant: complex(-0.7, 0.3),
+		view:          fractal.Viewport{Center: complex(0.1, 0.2), Width: 0.5, Height: 0.25, Rotation: 0.3},
+		settings: fractal.Settings{
+			MaxIterations:  1234,
+			BailoutRadius:  2.5,
+			SampleRatio:    6,
+			ColorFrequency: 0.75,
+			ColorOffset:    0.125,
+			Decomposition:  fractal.AngleDecomposition | fractal.FieldLines,
+			Layers: []fractal.Layer{
+				fractal.NewPaletteLayer(palette.Palette{palette.Black, palette.Green}, color.RGBA{1, 2, 3, 255}),
+				fractal.NewPaletteLayer(palette.Palette{palette.White}, palette.Black),
+				trap,
+				glow,
+				fractal.NewSlopeLayer(light),
+			},
+		},
+	}
+
+	fr, s := e.fractal()
+	if fr.IsMandelbrot() || fr.JuliaConstant() != e.juliaConstant || fr.Viewport() != e.view {
+		t.Errorf("restored %v fractal at %+v, want Julia %v at %+v",
+			fr.JuliaConstant(), fr.Viewport(), e.juliaConstant, e.view)
+	}
+	// Without edits a render keeps the settings as they are.
+	edits = make(map[interface{}]bool)
+	if got := applyEdits(s); !reflect.DeepEqual(got, e.settings) {
+		t.Errorf("restored settings %+v, want %+v", got, e.settings)
+	}
+}
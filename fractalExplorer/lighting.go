@@ -0,0 +1,83 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"fmt"
+	"github.com/mattn/go-gtk/gtk"
+	"math"
+	"saph/fractal"
+	"strconv"
+)
+
+// lighting is the light of the shading layer.
+var lighting = fractal.DefaultLighting
+
+// editLighting asks for the light of the shading and turns shading on.
+// An image that is already shaded is only recolored.
+func editLighting() {
+	light, ok := askLighting(lighting)
+	if !ok {
+		return
+	}
+	lighting = light
+	if !shadingCheckbutton.GetActive() {
+		shadingCheckbutton.SetActive(true)
+		render()
+		return
+	}
+	settings = withLighting(settings, light)
+	recolor(settings)
+}
+
+// withLighting returns s with the light of its slope layers replaced.
+func withLighting(s fractal.Settings, light fractal.Lighting) fractal.Settings {
+	s.Layers = append([]fractal.Layer(nil), s.Layers...)
+	for i := range s.Layers {
+		if s.Layers[i].Kind == fractal.SlopeLayer {
+			s.Layers[i].Lighting = light
+		}
+	}
+	return s
+}
+
+// askLighting asks for the angle of the light, the height scale and the
+// ambient light, starting from light.
+func askLighting(light fractal.Lighting) (fractal.Lighting, bool) {
+	dialog := gtk.NewDialog()
+	dialog.SetTitle("Lighting")
+	dialog.SetTransientFor(window)
+	defer dialog.Destroy()
+
+	entry := func(label string, value float64) *gtk.Entry {
+		e := gtk.NewEntry()
+		e.SetText(strconv.FormatFloat(value, 'g', 4, 64))
+		hbox := gtk.NewHBox(false, 5)
+		hbox.PackStart(NewLeftAlignedLabel(label), true, true, 0)
+		hbox.PackStart(e, false, false, 0)
+		dialog.GetVBox().PackStart(hbox, false, false, 5)
+		return e
+	}
+	angleEntry := entry("Light angle (degrees)", light.Azimuth*180/math.Pi)
+	heightEntry := entry("Height scale", light.HeightScale)
+	ambientEntry := entry("Ambient (0 to 1)", light.Ambient)
+	dialog.AddButton(gtk.STOCK_CANCEL, gtk.RESPONSE_CANCEL)
+	dialog.AddButton(gtk.STOCK_OK, gtk.RESPONSE_OK)
+	dialog.ShowAll()
+	if dialog.Run() != gtk.RESPONSE_OK {
+		return light, false
+	}
+
+	angle, err1 := strconv.ParseFloat(angleEntry.GetText(), 64)
+	height, err2 := strconv.ParseFloat(heightEntry.GetText(), 64)
+	ambient, err3 := strconv.ParseFloat(ambientEntry.GetText(), 64)
+	if err1 != nil || err2 != nil || err3 != nil || height < 0 || ambient < 0 || ambient > 1 {
+		showError(fmt.Errorf("invalid lighting"))
+		return light, false
+	}
+	light.Azimuth = angle * math.Pi / 180
+	light.HeightScale = height
+	light.Ambient = ambient
+	return light, true
+}
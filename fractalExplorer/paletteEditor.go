@@ -0,0 +1,397 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"fmt"
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/glib"
+	"github.com/mattn/go-gtk/gtk"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"os"
+	"path/filepath"
+	"saph/graphic/palette"
+	"strings"
+)
+
+const (
+	editorWidth       = 512
+	editorStripH      = 40 // height of the gradient preview strip
+	editorMarkerH     = 16 // height of the stop markers below the strip
+	editorMarkerW     = 7
+	editorStopCount   = 8 // stops of gradients approximated from palettes
+	customPaletteName = "Custom"
+)
+
+// paletteEditor is a window for editing the stops of a gradient while
+// the current image is recolored from its samples.
+type paletteEditor struct {
+	window        *gtk.Window
+	area          *gtk.DrawingArea
+	areaGC        *gdk.GC
+	colorButton   *gtk.ColorButton
+	easingCombo   *gtk.ComboBoxText
+	spaceCombo    *gtk.ComboBoxText
+	gradient      palette.Gradient
+	selected      int
+	dragging      bool
+	updating      bool // set while the widgets are updated from the gradient
+	previewQueued bool
+}
+
+var editor *paletteEditor
+
+// showPaletteEditor opens the palette editor on the palette chosen in the
+// Palette combo box.
+func showPaletteEditor() {
+	if editor != nil {
+		editor.window.Present()
+		return
+	}
+	name := paletteComboBoxText.GetActiveText()
+	g, ok := palettes.Gradient(name)
+	if !ok {
+		p, _ := palettes.Palette(name)
+		g = p.Gradient(editorStopCount)
+	}
+	editor = newPaletteEditor(g)
+	editor.window.ShowAll()
+}
+
+func newPaletteEditor(g palette.Gradient) *paletteEditor {
+	e := &paletteEditor{gradient: g}
+	e.gradient.Stops = append([]palette.Stop(nil), g.Stops...)
+
+	e.window = gtk.NewWindow(gtk.WINDOW_TOPLEVEL)
+	e.window.SetTitle("Palette editor")
+	e.window.SetTransientFor(window)
+	e.window.Connect("destroy", func() {
+		editor = nil
+		recolor(settings)
+	})
+
+	vbox := gtk.NewVBox(false, 5)
+	vbox.SetBorderWidth(5)
+	e.window.Add(vbox)
+
+	//~~~~~~~~~~~~ DrawingArea - Gradient ~~~~~~~~~~~~
+	e.area = gtk.NewDrawingArea()
+	e.area.SetSizeRequest(editorWidth, editorStripH+editorMarkerH)
+	e.area.Connect("expose-event", e.draw)
+	e.area.Connect("button-press-event", e.press)
+	e.area.Connect("motion-notify-event", e.motion)
+	e.area.Connect("button-release-event", func() { e.dragging = false })
+	e.area.SetEvents(int(gdk.BUTTON_PRESS_MASK | gdk.BUTTON_RELEASE_MASK | gdk.BUTTON_MOTION_MASK))
+	frame := gtk.NewFrame("Click to add a stop, drag to move it")
+	frame.Add(e.area)
+	vbox.PackStart(frame, true, true, 0)
+
+	//~~~~~~~~~~~~ Selected stop ~~~~~~~~~~~~
+	hbox := gtk.NewHBox(false, 5)
+	vbox.PackStart(hbox, false, false, 0)
+
+	e.colorButton = gtk.NewColorButton()
+	e.colorButton.Connect("color-set", func() {
+		c := e.colorButton.GetColor()
+		e.gradient.Stops[e.selected].Color = color.RGBA{uint8(c.Red() >> 8), uint8(c.Green() >> 8), uint8(c.Blue() >> 8), 0xFF}
+		e.changed()
+	})
+	hbox.PackStart(NewLeftAlignedLabel("Stop color:"), false, false, 0)
+	hbox.PackStart(e.colorButton, false, false, 0)
+
+	e.easingCombo = gtk.NewComboBoxText()
+	for _, easing := range []palette.Easing{palette.Linear, palette.EaseIn, palette.EaseOut, palette.EaseInOut} {
+		e.easingCombo.AppendText(easing.String())
+	}
+	e.easingCombo.Connect("changed", func() {
+		if e.updating {
+			return
+		}
+		e.gradient.Stops[e.selected].Easing = palette.Easing(e.easingCombo.GetActive())
+		e.changed()
+	})
+	hbox.PackStart(NewLeftAlignedLabel("Easing:"), false, false, 0)
+	hbox.PackStart(e.easingCombo, false, false, 0)
+
+	button := gtk.NewButtonWithLabel("Remove stop")
+	button.Clicked(func() {
+		if len(e.gradient.Stops) <= 1 {
+			return
+		}
+		stops := e.gradient.Stops
+		e.gradient.Stops = append(stops[:e.selected], stops[e.selected+1:]...)
+		if e.selected >= len(e.gradient.Stops) {
+			e.selected = len(e.gradient.Stops) - 1
+		}
+		e.changed()
+	})
+	hbox.PackEnd(button, false, false, 0)
+
+	//~~~~~~~~~~~~ Interpolation ~~~~~~~~~~~~
+	hbox = gtk.NewHBox(false, 5)
+	vbox.PackStart(hbox, false, false, 0)
+	e.spaceCombo = gtk.NewComboBoxText()
+	for _, space := range palette.Spaces() {
+		e.spaceCombo.AppendText(space.String())
+	}
+	e.spaceCombo.SetActive(int(e.gradient.Space))
+	e.spaceCombo.Connect("changed", func() {
+		e.gradient.Space = palette.Space(e.spaceCombo.GetActive())
+		e.changed()
+	})
+	hbox.PackStart(NewLeftAlignedLabel("Interpolation:"), false, false, 0)
+	hbox.PackStart(e.spaceCombo, false, false, 0)
+
+	//~~~~~~~~~~~~ Buttons ~~~~~~~~~~~~
+	hbox = gtk.NewHBox(true, 5)
+	vbox.PackStart(hbox, false, false, 0)
+
+	button = gtk.NewButtonWithLabel("Load...")
+	button.Clicked(e.load)
+	hbox.PackStart(button, true, true, 0)
+
+	button = gtk.NewButtonWithLabel("From image...")
+	button.Clicked(e.fromImage)
+	hbox.PackStart(button, true, true, 0)
+
+	button = gtk.NewButtonWithLabel("Save...")
+	button.Clicked(e.save)
+	hbox.PackStart(button, true, true, 0)
+
+	button = gtk.NewButtonWithLabel("Apply")
+	button.Clicked(e.apply)
+	hbox.PackStart(button, true, true, 0)
+
+	button = gtk.NewButtonWithLabel("Close")
+	button.Clicked(func() { e.window.Destroy() })
+	hbox.PackStart(button, true, true, 0)
+
+	e.updateStopWidgets()
+	return e
+}
+
+// changed redraws the editor and queues a recoloring of the image.
+func (e *paletteEditor) changed() {
+	e.updateStopWidgets()
+	e.area.GetWindow().Invalidate(nil, false)
+	if e.previewQueued {
+		return
+	}
+	e.previewQueued = true
+	glib.IdleAdd(func() bool {
+		e.previewQueued = false
+		recolor(withPalette(settings, e.gradient.Palette(palette.GradientSize)))
+		return false
+	})
+}
+
+// updateStopWidgets shows the color and easing of the selected stop.
+func (e *paletteEditor) updateStopWidgets() {
+	e.updating = true
+	defer func() { e.updating = false }()
+	stop := e.gradient.Stops[e.selected]
+	e.colorButton.SetColor(gdk.NewColor(fmt.Sprintf("#%02X%02X%02X", stop.Color.R, stop.Color.G, stop.Color.B)))
+	e.easingCombo.SetActive(int(stop.Easing))
+}
+
+func (e *paletteEditor) draw() {
+	var allocation gtk.Allocation
+	e.area.GetAllocation(&allocation)
+	width, height := allocation.Width, allocation.Height
+	if width <= 0 || height <= editorMarkerH {
+		return
+	}
+	drawable := e.area.GetWindow().GetDrawable()
+	if e.areaGC == nil {
+		e.areaGC = gdk.NewGC(drawable)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	strip := e.gradient.Palette(width)
+	for x := 0; x < width; x++ {
+		for y := 0; y < height-editorMarkerH; y++ {
+			img.SetRGBA(x, y, strip[x])
+		}
+		for y := height - editorMarkerH; y < height; y++ {
+			img.SetRGBA(x, y, palette.White)
+		}
+	}
+	for i, stop := range e.gradient.Stops {
+		border := palette.Black
+		if i == e.selected {
+			border = palette.Red
+		}
+		x0 := e.stopX(stop, width) - editorMarkerW/2
+		for x := x0; x < x0+editorMarkerW; x++ {
+			for y := height - editorMarkerH; y < height; y++ {
+				c := stop.Color
+				if x == x0 || x == x0+editorMarkerW-1 || y == height-editorMarkerH || y == height-1 {
+					c = border
+				}
+				if x >= 0 && x < width {
+					img.SetRGBA(x, y, c)
+				}
+			}
+		}
+	}
+	drawRGBA(drawable, e.areaGC, img, 0, 0)
+}
+
+func (e *paletteEditor) stopX(stop palette.Stop, width int) int {
+	return int(stop.Position * float64(width))
+}
+
+// press selects the stop under the pointer, or adds one there.
+func (e *paletteEditor) press() {
+	var allocation gtk.Allocation
+	e.area.GetAllocation(&allocation)
+	var x, y int
+	var mt gdk.ModifierType
+	e.area.GetWindow().GetPointer(&x, &y, &mt)
+
+	for i, stop := range e.gradient.Stops {
+		d := e.stopX(stop, allocation.Width) - x
+		if d >= -editorMarkerW && d <= editorMarkerW {
+			e.selected = i
+			e.dragging = true
+			e.changed()
+			return
+		}
+	}
+	t := float64(x) / float64(allocation.Width)
+	e.gradient.Stops = append(e.gradient.Stops, palette.Stop{Position: t, Color: e.gradient.At(t)})
+	e.selected = len(e.gradient.Stops) - 1
+	e.dragging = true
+	e.changed()
+}
+
+// motion moves the selected stop while dragging.
+func (e *paletteEditor) motion() {
+	if !e.dragging {
+		return
+	}
+	var allocation gtk.Allocation
+	e.area.GetAllocation(&allocation)
+	var x, y int
+	var mt gdk.ModifierType
+	e.area.GetWindow().GetPointer(&x, &y, &mt)
+	t := float64(x) / float64(allocation.Width)
+	if t < 0 {
+		t = 0
+	}
+	if t >= 1 {
+		t = float64(allocation.Width-1) / float64(allocation.Width)
+	}
+	e.gradient.Stops[e.selected].Position = t
+	e.changed()
+}
+
+func (e *paletteEditor) load() {
+	filename, ok := chooseFile("Load palette", gtk.FILE_CHOOSER_ACTION_OPEN, "", "*.ggr", "*.ugr", "*.map")
+	if !ok {
+		return
+	}
+	g, err := loadGradient(filename)
+	if err == nil && len(g.Stops) == 0 {
+		err = fmt.Errorf("%s: empty gradient", filename)
+	}
+	if err != nil {
+		showError(err)
+		return
+	}
+	e.gradient = g
+	e.selected = 0
+	e.spaceCombo.SetActive(int(g.Space))
+	e.changed()
+}
+
+// fromImage replaces the gradient with the dominant colors of an image.
+func (e *paletteEditor) fromImage() {
+	filename, ok := chooseFile("Palette from image", gtk.FILE_CHOOSER_ACTION_OPEN, "", "*.png", "*.jpg", "*.jpeg", "*.gif")
+	if !ok {
+		return
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		showError(err)
+		return
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		showError(fmt.Errorf("%s: %v", filename, err))
+		return
+	}
+	colors := palette.ExtractColors(img, editorStopCount)
+	if len(colors) == 0 {
+		showError(fmt.Errorf("%s: no opaque pixels", filename))
+		return
+	}
+	e.gradient = palette.CyclicGradient(colors, palette.OKLabSpace)
+	e.selected = 0
+	e.spaceCombo.SetActive(int(e.gradient.Space))
+	e.changed()
+}
+
+func (e *paletteEditor) save() {
+	filename, ok := chooseFile("Save palette", gtk.FILE_CHOOSER_ACTION_SAVE, "custom.ggr", "*.ggr", "*.map")
+	if !ok {
+		return
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		showError(err)
+		return
+	}
+	defer file.Close()
+	name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	if strings.ToLower(filepath.Ext(filename)) == ".map" {
+		err = palette.WriteMap(file, e.gradient.Palette(palette.GradientSize))
+	} else {
+		err = palette.WriteGGR(file, palette.NamedGradient{Name: name, Gradient: e.gradient})
+	}
+	if err != nil {
+		showError(err)
+	}
+}
+
+// apply makes the edited gradient the Custom palette used for rendering.
+func (e *paletteEditor) apply() {
+	g := e.gradient
+	g.Stops = append([]palette.Stop(nil), g.Stops...)
+	palettes.AddGradient(customPaletteName, g)
+	syncComboBoxes()
+	setActiveName(paletteComboBoxText, palettes.PaletteNames(), customPaletteName)
+	p, _ := palettes.Palette(customPaletteName)
+	settings = withPalette(settings, p)
+}
+
+// loadGradient reads the first gradient of a palette file. Map palettes
+// are approximated by evenly spaced stops.
+func loadGradient(filename string) (palette.Gradient, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return palette.Gradient{}, err
+	}
+	defer file.Close()
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ggr":
+		ng, err := palette.ReadGGR(file)
+		return ng.Gradient, err
+	case ".ugr":
+		gradients, err := palette.ReadUGR(file)
+		if err != nil {
+			return palette.Gradient{}, err
+		}
+		return gradients[0].Gradient, nil
+	}
+	p, err := palette.ReadMap(file)
+	if err != nil {
+		return palette.Gradient{}, err
+	}
+	return p.Gradient(editorStopCount), nil
+}
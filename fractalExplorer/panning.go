@@ -0,0 +1,84 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package main
+
+import (
+	"github.com/mattn/go-gtk/gdk"
+	"github.com/mattn/go-gtk/glib"
+	"image"
+	"time"
+)
+
+// panning is a drag of the image with the middle button or shift+left.
+// The image follows the pointer, and on release only the pixels that
+// come into view are rendered.
+type panning struct {
+	active bool
+	start  image.Point
+	offset image.Point // of the image from where it was when the drag started
+	gc     *gdk.GC
+}
+
+var pan = &panning{}
+
+func (p *panning) begin(point image.Point) {
+	p.active, p.start, p.offset = true, point, image.Point{}
+	drawingarea.GetWindow().SetCursor(gdk.NewCursor(gdk.FLEUR))
+}
+
+func (p *panning) move(point image.Point) {
+	p.offset = point.Sub(p.start)
+	drawingarea.GetWindow().Invalidate(nil, false)
+}
+
+// end moves the view along with the image and renders what came into view.
+func (p *panning) end(point image.Point) {
+	p.move(point)
+	p.active = false
+	drawingarea.GetWindow().SetCursor(gdk.NewCursor(gdk.TCROSS))
+	if p.offset == (image.Point{}) {
+		return
+	}
+
+	// Move the pixels already drawn and clear those coming into view.
+	drawable := pixmap.GetDrawable()
+	drawable.DrawDrawable(gc, drawable, 0, 0, p.offset.X, p.offset.Y, -1, -1)
+	p.clear(drawable)
+
+	renderLock()
+	var err error
+	if pixChan, err = frac.Pan(imageSize, p.offset.X, p.offset.Y, settings); err != nil {
+		renderUnlock()
+		showError(err)
+		return
+	}
+	before = time.Now()
+	glib.IdleAdd(printPixChan)
+}
+
+// draw draws the image moved by the drag so far onto drawable.
+func (p *panning) draw(drawable *gdk.Drawable) {
+	drawable.DrawDrawable(gc, pixmap.GetDrawable(), 0, 0, p.offset.X, p.offset.Y, -1, -1)
+	p.clear(drawable)
+}
+
+// clear fills the strips of drawable left uncovered by the moved image.
+func (p *panning) clear(drawable *gdk.Drawable) {
+	if p.gc == nil {
+		p.gc = gdk.NewGC(drawable)
+		p.gc.SetRgbFgColor(gdk.NewColor("white"))
+	}
+	w, h := imageSize.Width, imageSize.Height
+	dx, dy := p.offset.X, p.offset.Y
+	if dx > 0 {
+		drawable.DrawRectangle(p.gc, true, 0, 0, dx, h)
+	} else if dx < 0 {
+		drawable.DrawRectangle(p.gc, true, w+dx, 0, -dx, h)
+	}
+	if dy > 0 {
+		drawable.DrawRectangle(p.gc, true, 0, 0, w, dy)
+	} else if dy < 0 {
+		drawable.DrawRectangle(p.gc, true, 0, h+dy, w, -dy)
+	}
+}
@@ -0,0 +1,152 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package graphic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"saph/graphic/pngchunk"
+	"time"
+)
+
+// APNGWriter writes an animated PNG frame by frame, without holding the
+// frames in memory. All frames must have the same size and color model.
+type APNGWriter struct {
+	w        io.Writer
+	frames   int
+	delay    time.Duration
+	loops    int
+	written  int
+	sequence uint32 // of the fcTL and fdAT chunks
+	header   []byte // IHDR of the first frame
+}
+
+// NewAPNGWriter starts an animated PNG of the given number of frames,
+// shown delay apart and played loops times, or forever if loops is 0.
+func NewAPNGWriter(w io.Writer, frames int, delay time.Duration, loops int) *APNGWriter {
+	return &APNGWriter{w: w, frames: frames, delay: delay, loops: loops}
+}
+
+// WriteFrame adds the next frame.
+func (a *APNGWriter) WriteFrame(img image.Image) error {
+	if a.written == a.frames {
+		return errors.New("graphic: too many APNG frames")
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	chunks, err := pngchunk.Read(&buf)
+	if err != nil {
+		return err
+	}
+
+	var out []pngchunk.Chunk
+	for _, c := range chunks {
+		switch c.Type {
+		case "IHDR":
+			if a.header == nil {
+				a.header = c.Data
+				if _, err := io.WriteString(a.w, pngchunk.Signature); err != nil {
+					return err
+				}
+				out = append(out, c, a.animationControl())
+			} else if !bytes.Equal(c.Data, a.header) {
+				return fmt.Errorf("graphic: APNG frame %d differs in size or color model", a.written)
+			}
+			fc, err := a.frameControl(img.Bounds())
+			if err != nil {
+				return err
+			}
+			out = append(out, fc)
+		case "IDAT":
+			if a.written == 0 {
+				out = append(out, c)
+			} else {
+				data := make([]byte, 4, 4+len(c.Data))
+				binary.BigEndian.PutUint32(data, a.nextSequence())
+				out = append(out, pngchunk.Chunk{Type: "fdAT", Data: append(data, c.Data...)})
+			}
+		}
+	}
+	for _, c := range out {
+		if err := pngchunk.WriteChunk(a.w, c); err != nil {
+			return err
+		}
+	}
+	a.written++
+	return nil
+}
+
+// Close ends the animation. It fails if fewer frames than announced were
+// written.
+func (a *APNGWriter) Close() error {
+	if a.written != a.frames {
+		return fmt.Errorf("graphic: APNG has %d of %d frames", a.written, a.frames)
+	}
+	return pngchunk.WriteChunk(a.w, pngchunk.Chunk{Type: "IEND"})
+}
+
+func (a *APNGWriter) nextSequence() uint32 {
+	a.sequence++
+	return a.sequence - 1
+}
+
+// animationControl is the acTL chunk: the number of frames and plays.
+func (a *APNGWriter) animationControl() pngchunk.Chunk {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data[0:], uint32(a.frames))
+	binary.BigEndian.PutUint32(data[4:], uint32(a.loops))
+	return pngchunk.Chunk{Type: "acTL", Data: data}
+}
+
+// frameControl is the fcTL chunk of the next frame, covering the whole
+// image for the frame delay.
+func (a *APNGWriter) frameControl(r image.Rectangle) (pngchunk.Chunk, error) {
+	num, den, err := apngDelay(a.delay, a.written)
+	if err != nil {
+		return pngchunk.Chunk{}, err
+	}
+	data := make([]byte, 26)
+	binary.BigEndian.PutUint32(data[0:], a.nextSequence())
+	binary.BigEndian.PutUint32(data[4:], uint32(r.Dx()))
+	binary.BigEndian.PutUint32(data[8:], uint32(r.Dy()))
+	// Offset 0, 0, then the delay.
+	binary.BigEndian.PutUint16(data[20:], num)
+	binary.BigEndian.PutUint16(data[22:], den)
+	// Dispose and blend ops are 0: keep the frame, replace the pixels.
+	return pngchunk.Chunk{Type: "fcTL", Data: data}, nil
+}
+
+// apngDelay returns the delay of frame i as the fraction num/den of a
+// second. Delays that are such a fraction of 16-bit numbers are exact.
+// Others are rounded to milliseconds, alternating between the nearest
+// ones like GIF delays to keep the average, and may be at most 65.535s.
+func apngDelay(delay time.Duration, i int) (num, den uint16, err error) {
+	if delay < 0 {
+		return 0, 0, fmt.Errorf("graphic: negative APNG delay %v", delay)
+	}
+	g := gcd(int64(delay), int64(time.Second))
+	if n, d := int64(delay)/g, int64(time.Second)/g; n <= math.MaxUint16 && d <= math.MaxUint16 {
+		return uint16(n), uint16(d), nil
+	}
+	if delay > math.MaxUint16*time.Millisecond {
+		return 0, 0, fmt.Errorf("graphic: APNG delay %v does not fit in 16 bits", delay)
+	}
+	ms := func(t time.Duration) int64 { return int64((t + time.Millisecond/2) / time.Millisecond) }
+	return uint16(ms(time.Duration(i+1)*delay) - ms(time.Duration(i)*delay)), 1000, nil
+}
+
+func gcd(a, b int64) int64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
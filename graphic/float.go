@@ -0,0 +1,82 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package graphic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+)
+
+// FloatImage is an opaque RGB image with float32 channels, nominally in
+// [0, 1]. It keeps colors at full precision until they are written.
+type FloatImage struct {
+	Pix    []float32 // R, G, B of each pixel, row by row
+	Stride int
+	Rect   image.Rectangle
+}
+
+func NewFloatImage(r image.Rectangle) *FloatImage {
+	return &FloatImage{
+		Pix:    make([]float32, 3*r.Dx()*r.Dy()),
+		Stride: 3 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+func (p *FloatImage) ColorModel() color.Model { return color.RGBA64Model }
+func (p *FloatImage) Bounds() image.Rectangle { return p.Rect }
+func (p *FloatImage) Opaque() bool            { return true }
+
+func (p *FloatImage) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*3
+}
+
+// At quantizes the pixel at x, y to 16 bits per channel.
+func (p *FloatImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color.RGBA64{}
+	}
+	i := p.PixOffset(x, y)
+	return color.RGBA64{word(p.Pix[i]), word(p.Pix[i+1]), word(p.Pix[i+2]), 0xFFFF}
+}
+
+func (p *FloatImage) SetRGB(x, y int, r, g, b float32) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	p.Pix[i], p.Pix[i+1], p.Pix[i+2] = r, g, b
+}
+
+func word(x float32) uint16 {
+	return uint16(math.Max(0, math.Min(1, float64(x)))*0xFFFF + 0.5)
+}
+
+// WritePFM writes img in the Portable Float Map format: little-endian
+// float32 RGB, bottom row first. The channels are written as they are,
+// without any change of transfer function.
+func WritePFM(w io.Writer, img *FloatImage) error {
+	bw := bufio.NewWriter(w)
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	// A negative scale marks little-endian data.
+	if _, err := fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", width, height); err != nil {
+		return err
+	}
+	row := make([]byte, 4*img.Stride)
+	for y := img.Rect.Max.Y - 1; y >= img.Rect.Min.Y; y-- {
+		i := img.PixOffset(img.Rect.Min.X, y)
+		for k, v := range img.Pix[i : i+img.Stride] {
+			binary.LittleEndian.PutUint32(row[4*k:], math.Float32bits(v))
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,100 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package graphic
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FrameFilename is the file name of frame i of a numbered PNG sequence.
+func FrameFilename(dir string, i int) string {
+	return filepath.Join(dir, fmt.Sprintf("frame%05d.png", i))
+}
+
+// SavePNG writes img to a PNG file.
+func SavePNG(filename string, img image.Image) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// FrameWriter writes the frames of an animation in order.
+type FrameWriter interface {
+	WriteFrame(img image.Image) error
+	Close() error
+}
+
+// CreateFrameWriter creates an animation named name: an animated GIF for
+// a .gif name, an APNG for .png or .apng, and otherwise a directory of
+// numbered PNGs. The frames are shown delay apart and played loops times,
+// or forever if loops is 0. p is the palette of a GIF, see GIFWriter.
+// GIF frames can't be shown less than 10ms apart.
+func CreateFrameWriter(name string, frames int, delay time.Duration, loops int, p color.Palette) (FrameWriter, error) {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".gif" && delay < 10*time.Millisecond {
+		return nil, fmt.Errorf("graphic: GIF frames need a delay of at least 10ms, not %v", delay)
+	}
+	if ext == ".png" || ext == ".apng" {
+		if _, _, err := apngDelay(delay, 0); err != nil {
+			return nil, err
+		}
+	}
+	if ext != ".gif" && ext != ".png" && ext != ".apng" {
+		if err := os.MkdirAll(name, 0755); err != nil {
+			return nil, err
+		}
+		return &frameDir{dir: name}, nil
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if ext == ".gif" {
+		g := NewGIFWriter(file, delay, loops)
+		g.Palette = p
+		return &frameFile{g, file}, nil
+	}
+	return &frameFile{NewAPNGWriter(file, frames, delay, loops), file}, nil
+}
+
+// frameDir writes numbered PNGs, see FrameFilename.
+type frameDir struct {
+	dir    string
+	frames int
+}
+
+func (d *frameDir) WriteFrame(img image.Image) error {
+	d.frames++
+	return SavePNG(FrameFilename(d.dir, d.frames-1), img)
+}
+
+func (d *frameDir) Close() error { return nil }
+
+// frameFile closes the file of an animation after its writer.
+type frameFile struct {
+	FrameWriter
+	file *os.File
+}
+
+func (f *frameFile) Close() error {
+	if err := f.FrameWriter.Close(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
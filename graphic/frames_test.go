@@ -0,0 +1,201 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package graphic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"saph/graphic/pngchunk"
+	"testing"
+	"time"
+)
+
+func testFrame(c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestGIFDelays(t *testing.T) {
+	for _, c := range []struct {
+		delay time.Duration
+		want  []int
+	}{
+		{40 * time.Millisecond, []int{4, 4, 4, 4, 4, 4}},
+		{time.Second / 30, []int{3, 4, 3, 3, 4, 3}},
+		{time.Second / 60, []int{2, 1, 2, 2, 1, 2}},
+		{15 * time.Millisecond, []int{2, 1, 2, 1, 2, 1}},
+	} {
+		var buf bytes.Buffer
+		g := NewGIFWriter(&buf, c.delay, 0)
+		g.Palette = color.Palette{color.Black, color.White}
+		for range c.want {
+			if err := g.WriteFrame(testFrame(color.White)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := g.Close(); err != nil {
+			t.Fatal(err)
+		}
+		anim, err := gif.DecodeAll(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range c.want {
+			if anim.Delay[i] != c.want[i] {
+				t.Errorf("delay %v: frame delays %v, want %v", c.delay, anim.Delay, c.want)
+				break
+			}
+		}
+	}
+}
+
+func TestCreateFrameWriterGIFDelay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "frames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "fast.gif")
+	if _, err := CreateFrameWriter(name, 2, time.Second/120, 0, nil); err == nil {
+		t.Error("GIF at 120 fps accepted")
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Error("GIF created despite the error")
+	}
+	w, err := CreateFrameWriter(filepath.Join(dir, "fast.png"), 1, time.Second/120, 0, nil)
+	if err != nil {
+		t.Fatalf("APNG at 120 fps: %v", err)
+	}
+	w.WriteFrame(testFrame(color.Black))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAPNGChunks(t *testing.T) {
+	var buf bytes.Buffer
+	a := NewAPNGWriter(&buf, 3, 40*time.Millisecond, 2)
+	for _, c := range []color.Color{color.Black, color.White, color.Black} {
+		if err := a.WriteFrame(testFrame(c)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// Viewers without APNG support show the first frame.
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 4, 3) {
+		t.Errorf("default image bounds %v", img.Bounds())
+	}
+
+	chunks, err := pngchunk.Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	var sequence []uint32
+	for _, c := range chunks {
+		types = append(types, c.Type)
+		switch c.Type {
+		case "acTL":
+			if frames, plays := binary.BigEndian.Uint32(c.Data), binary.BigEndian.Uint32(c.Data[4:]); frames != 3 || plays != 2 {
+				t.Errorf("acTL %d frames, %d plays", frames, plays)
+			}
+		case "fcTL":
+			sequence = append(sequence, binary.BigEndian.Uint32(c.Data))
+			if num, den := binary.BigEndian.Uint16(c.Data[20:]), binary.BigEndian.Uint16(c.Data[22:]); num != 1 || den != 25 {
+				t.Errorf("fcTL delay %d/%d, want 1/25 for 40ms", num, den)
+			}
+		case "fdAT":
+			sequence = append(sequence, binary.BigEndian.Uint32(c.Data))
+		}
+	}
+	want := []string{"IHDR", "acTL", "fcTL", "IDAT", "fcTL", "fdAT", "fcTL", "fdAT", "IEND"}
+	if len(types) != len(want) {
+		t.Fatalf("chunks %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("chunks %v, want %v", types, want)
+		}
+	}
+	for i, n := range sequence {
+		if n != uint32(i) {
+			t.Errorf("sequence numbers %v, want 0, 1, 2, ...", sequence)
+			break
+		}
+	}
+}
+
+func TestAPNGDelays(t *testing.T) {
+	for _, c := range []struct {
+		delay time.Duration
+		want  [][2]uint16
+	}{
+		{40 * time.Millisecond, [][2]uint16{{1, 25}, {1, 25}, {1, 25}}},
+		{100 * time.Microsecond, [][2]uint16{{1, 10000}, {1, 10000}, {1, 10000}}},
+		{2 * time.Minute, [][2]uint16{{120, 1}, {120, 1}, {120, 1}}},
+		{0, [][2]uint16{{0, 1}, {0, 1}, {0, 1}}},
+		// Not a fraction of 16-bit numbers: whole milliseconds that keep
+		// the average.
+		{time.Second / 30, [][2]uint16{{33, 1000}, {34, 1000}, {33, 1000}, {33, 1000}, {34, 1000}, {33, 1000}}},
+	} {
+		for i, want := range c.want {
+			num, den, err := apngDelay(c.delay, i)
+			if err != nil || num != want[0] || den != want[1] {
+				t.Errorf("delay %v of frame %d: %d/%d, %v, want %d/%d", c.delay, i, num, den, err, want[0], want[1])
+			}
+		}
+	}
+
+	for _, delay := range []time.Duration{-time.Millisecond, 70*time.Second + time.Millisecond} {
+		if _, _, err := apngDelay(delay, 0); err == nil {
+			t.Errorf("delay %v accepted", delay)
+		}
+		if err := NewAPNGWriter(new(bytes.Buffer), 1, delay, 0).WriteFrame(testFrame(color.Black)); err == nil {
+			t.Errorf("frame with delay %v accepted", delay)
+		}
+	}
+	dir, err := ioutil.TempDir("", "frames")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := CreateFrameWriter(filepath.Join(dir, "slow.png"), 2, 70*time.Second+time.Millisecond, 0, nil); err == nil {
+		t.Error("CreateFrameWriter accepted an APNG delay beyond 16 bits")
+	}
+}
+
+func TestAPNGFrameCount(t *testing.T) {
+	a := NewAPNGWriter(new(bytes.Buffer), 1, 40*time.Millisecond, 0)
+	if err := a.WriteFrame(testFrame(color.Black)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.WriteFrame(testFrame(color.Black)); err == nil {
+		t.Error("extra frame accepted")
+	}
+	a = NewAPNGWriter(new(bytes.Buffer), 2, 40*time.Millisecond, 0)
+	a.WriteFrame(testFrame(color.Black))
+	if err := a.Close(); err == nil {
+		t.Error("missing frame accepted")
+	}
+}
@@ -0,0 +1,70 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package graphic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"saph/graphic/palette"
+	"time"
+)
+
+// GIFWriter collects the frames of an animated GIF. The paletted frames
+// are held in memory until Close writes the file.
+type GIFWriter struct {
+	w io.Writer
+	// Palette is used for every frame. If it is nil, each frame gets
+	// its own palette of its dominant colors.
+	Palette color.Palette
+	delay   time.Duration
+	anim    gif.GIF
+}
+
+// NewGIFWriter starts an animated GIF with frames shown delay apart and
+// played loops times, or forever if loops is 0. GIF delays are whole
+// hundredths of a second, so the frames alternate between the nearest
+// ones to keep the average at delay.
+func NewGIFWriter(w io.Writer, delay time.Duration, loops int) *GIFWriter {
+	g := &GIFWriter{w: w, delay: delay}
+	// GIF counts the repetitions after the first play, with 0 for
+	// forever and -1 for none.
+	switch loops {
+	case 0:
+		g.anim.LoopCount = 0
+	case 1:
+		g.anim.LoopCount = -1
+	default:
+		g.anim.LoopCount = loops - 1
+	}
+	return g
+}
+
+// WriteFrame quantizes img to the palette, with dithering, and adds it.
+func (g *GIFWriter) WriteFrame(img image.Image) error {
+	p := g.Palette
+	if p == nil {
+		for _, c := range palette.ExtractColors(img, 256) {
+			p = append(p, c)
+		}
+	}
+	frame := image.NewPaletted(img.Bounds(), p)
+	draw.FloydSteinberg.Draw(frame, frame.Rect, img, img.Bounds().Min)
+	g.anim.Image = append(g.anim.Image, frame)
+	i := len(g.anim.Delay)
+	g.anim.Delay = append(g.anim.Delay, gifTime(time.Duration(i+1)*g.delay)-gifTime(time.Duration(i)*g.delay))
+	return nil
+}
+
+// gifTime rounds t to hundredths of a second.
+func gifTime(t time.Duration) int {
+	return int((t + 5*time.Millisecond) / (10 * time.Millisecond))
+}
+
+// Close writes the animation.
+func (g *GIFWriter) Close() error {
+	return gif.EncodeAll(g.w, &g.anim)
+}
@@ -0,0 +1,224 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+const (
+	extractMaxSamples = 1 << 16 // pixels considered by Extract
+	kMeansIterations  = 10
+)
+
+// Extract derives a cyclic palette from the n dominant colors of img.
+// See ExtractColors.
+func Extract(img image.Image, n int) Palette {
+	return CyclicGradient(ExtractColors(img, n), OKLabSpace).Palette(GradientSize)
+}
+
+// ExtractColors finds the n dominant colors of img by median cut in OKLab,
+// refined with k-means. The colors are ordered along a short closed path,
+// starting with the darkest, so that neighbouring colors look alike and the
+// cycle wraps around smoothly. Fewer colors are returned if the image has
+// fewer distinct ones; transparent pixels are ignored.
+func ExtractColors(img image.Image, n int) []color.RGBA {
+	points := samplePixels(img)
+	if len(points) == 0 || n < 1 {
+		return nil
+	}
+	centers := medianCut(points, n)
+	centers = kMeans(points, centers)
+	centers = orderPath(centers)
+
+	colors := make([]color.RGBA, len(centers))
+	for i, c := range centers {
+		colors[i] = OKLabSpace.toRGB(c)
+	}
+	return colors
+}
+
+// samplePixels converts evenly spread opaque pixels of img to OKLab.
+func samplePixels(img image.Image) [][3]float64 {
+	b := img.Bounds()
+	step := 1
+	for b.Dx()*b.Dy()/(step*step) > extractMaxSamples {
+		step++
+	}
+	var points [][3]float64
+	for y := b.Min.Y; y < b.Max.Y; y += step {
+		for x := b.Min.X; x < b.Max.X; x += step {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 0x80 {
+				continue
+			}
+			points = append(points, OKLabSpace.fromRGB(color.RGBA{c.R, c.G, c.B, 0xFF}))
+		}
+	}
+	return points
+}
+
+// medianCut splits the points into at most n boxes, each time halving the
+// box with the widest spread at the median of its widest axis, and returns
+// the box means.
+func medianCut(points [][3]float64, n int) [][3]float64 {
+	boxes := [][][3]float64{points}
+	for len(boxes) < n {
+		best, bestAxis, bestSpread := -1, 0, 0.0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			axis, spread := widestAxis(box)
+			// Weigh by size so that large clusters are split first.
+			spread *= math.Sqrt(float64(len(box)))
+			if spread > bestSpread {
+				best, bestAxis, bestSpread = i, axis, spread
+			}
+		}
+		if best < 0 {
+			break
+		}
+		box := boxes[best]
+		sort.Slice(box, func(i, j int) bool { return box[i][bestAxis] < box[j][bestAxis] })
+		mid := splitIndex(box, bestAxis)
+		boxes[best] = box[:mid]
+		boxes = append(boxes, box[mid:])
+	}
+
+	centers := make([][3]float64, len(boxes))
+	for i, box := range boxes {
+		centers[i] = mean(box)
+	}
+	return centers
+}
+
+// splitIndex is the index nearest the median of the box sorted along axis
+// that does not separate equal values, so that a color is not split in two.
+func splitIndex(box [][3]float64, axis int) int {
+	mid := len(box) / 2
+	for d := 0; d < len(box); d++ {
+		for _, i := range []int{mid - d, mid + d} {
+			if i > 0 && i < len(box) && box[i-1][axis] != box[i][axis] {
+				return i
+			}
+		}
+	}
+	return mid
+}
+
+func widestAxis(points [][3]float64) (int, float64) {
+	lo, hi := points[0], points[0]
+	for _, p := range points {
+		for k := range p {
+			lo[k] = math.Min(lo[k], p[k])
+			hi[k] = math.Max(hi[k], p[k])
+		}
+	}
+	axis := 0
+	for k := 1; k < 3; k++ {
+		if hi[k]-lo[k] > hi[axis]-lo[axis] {
+			axis = k
+		}
+	}
+	return axis, hi[axis] - lo[axis]
+}
+
+func mean(points [][3]float64) [3]float64 {
+	var m [3]float64
+	for _, p := range points {
+		for k := range p {
+			m[k] += p[k]
+		}
+	}
+	for k := range m {
+		m[k] /= float64(len(points))
+	}
+	return m
+}
+
+// kMeans moves the centers to the means of the points nearest to them.
+func kMeans(points, centers [][3]float64) [][3]float64 {
+	sums := make([][3]float64, len(centers))
+	counts := make([]int, len(centers))
+	for iter := 0; iter < kMeansIterations; iter++ {
+		for i := range sums {
+			sums[i], counts[i] = [3]float64{}, 0
+		}
+		for _, p := range points {
+			i := nearest(centers, p)
+			for k := range p {
+				sums[i][k] += p[k]
+			}
+			counts[i]++
+		}
+		for i := range centers {
+			// An empty cluster keeps its center.
+			if counts[i] == 0 {
+				continue
+			}
+			for k := range sums[i] {
+				centers[i][k] = sums[i][k] / float64(counts[i])
+			}
+		}
+	}
+	return centers
+}
+
+func nearest(centers [][3]float64, p [3]float64) int {
+	best, bestDist := 0, math.Inf(1)
+	for i, c := range centers {
+		if d := dist(c, p); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+func dist(a, b [3]float64) float64 {
+	dl, da, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
+
+// orderPath orders the colors as a short closed path: a nearest neighbour
+// tour from the darkest color, improved by 2-opt.
+func orderPath(colors [][3]float64) [][3]float64 {
+	n := len(colors)
+	if n < 3 {
+		return colors
+	}
+	start := 0
+	for i, c := range colors {
+		if c[0] < colors[start][0] {
+			start = i
+		}
+	}
+	path := [][3]float64{colors[start]}
+	left := append(append([][3]float64(nil), colors[:start]...), colors[start+1:]...)
+	for len(left) > 0 {
+		i := nearest(left, path[len(path)-1])
+		path = append(path, left[i])
+		left = append(left[:i], left[i+1:]...)
+	}
+
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < n-1; i++ {
+			for j := i + 2; j < n; j++ {
+				a, b := path[i], path[i+1]
+				c, d := path[j], path[(j+1)%n]
+				if dist(a, c)+dist(b, d) < dist(a, b)+dist(c, d)-1e-12 {
+					for l, r := i+1, j; l < r; l, r = l+1, r-1 {
+						path[l], path[r] = path[r], path[l]
+					}
+					improved = true
+				}
+			}
+		}
+	}
+	return path
+}
@@ -0,0 +1,90 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// stripes makes an image of vertical stripes, each as wide as its weight.
+func stripes(colors []color.NRGBA, weights []int) *image.NRGBA {
+	width := 0
+	for _, w := range weights {
+		width += w
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, width, 10))
+	x := 0
+	for i, c := range colors {
+		for end := x + weights[i]; x < end; x++ {
+			for y := 0; y < 10; y++ {
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+	return img
+}
+
+func TestExtractColors(t *testing.T) {
+	var (
+		black = color.NRGBA{0x00, 0x00, 0x00, 0xFF}
+		dark  = color.NRGBA{0x40, 0x40, 0x40, 0xFF}
+		grey  = color.NRGBA{0x80, 0x80, 0x80, 0xFF}
+		light = color.NRGBA{0xC0, 0xC0, 0xC0, 0xFF}
+		white = color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF}
+		clear = color.NRGBA{0xFF, 0x00, 0x00, 0x00}
+	)
+	// Shuffled and of different sizes, with transparent red to ignore.
+	img := stripes(
+		[]color.NRGBA{light, black, clear, white, grey, dark},
+		[]int{7, 3, 20, 11, 5, 2})
+	got := ExtractColors(img, 5)
+	// The path runs from the darkest color through its neighbours.
+	want := []color.RGBA{{0x00, 0x00, 0x00, 0xFF}, {0x40, 0x40, 0x40, 0xFF},
+		{0x80, 0x80, 0x80, 0xFF}, {0xC0, 0xC0, 0xC0, 0xFF}, White}
+	if len(got) != len(want) {
+		t.Fatalf("got %d colors %v, want %v", len(got), got, want)
+	}
+	for i := range want {
+		if !closeColors(got[i], want[i], 1) {
+			t.Errorf("color %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// Clustering merges the shades around each dominant color.
+	red, redder := color.NRGBA{0xE0, 0x10, 0x10, 0xFF}, color.NRGBA{0xF0, 0x00, 0x00, 0xFF}
+	blue, bluer := color.NRGBA{0x10, 0x10, 0xE0, 0xFF}, color.NRGBA{0x00, 0x00, 0xF0, 0xFF}
+	got = ExtractColors(stripes([]color.NRGBA{red, blue, redder, bluer}, []int{4, 4, 4, 4}), 2)
+	if len(got) != 2 {
+		t.Fatalf("got %d colors %v, want 2", len(got), got)
+	}
+	// Blue is darker than red in OKLab.
+	if got[0].B < 0xE0 || got[0].R > 0x10 || got[1].R < 0xE0 || got[1].B > 0x10 {
+		t.Errorf("got %v, want blue then red", got)
+	}
+
+	// An image with fewer colors gives fewer.
+	if got := ExtractColors(stripes([]color.NRGBA{black, white}, []int{3, 3}), 4); len(got) != 2 {
+		t.Errorf("got %d colors from two, want 2", len(got))
+	}
+	if got := ExtractColors(stripes([]color.NRGBA{clear}, []int{5}), 4); got != nil {
+		t.Errorf("got %v from a transparent image, want none", got)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	img := stripes([]color.NRGBA{{0xFF, 0xFF, 0xFF, 0xFF}, {0x00, 0x00, 0x00, 0xFF}}, []int{5, 5})
+	p := Extract(img, 2)
+	if len(p) != GradientSize {
+		t.Fatalf("got %d entries, want %d", len(p), GradientSize)
+	}
+	// A cycle from black through white and back.
+	if !closeColors(p[0], Black, 1) || !closeColors(p[GradientSize/2], White, 1) {
+		t.Errorf("entries %v and %v, want black and white", p[0], p[GradientSize/2])
+	}
+	if !closeColors(p[GradientSize-1], Black, 8) {
+		t.Errorf("last entry %v, want near black", p[GradientSize-1])
+	}
+}
@@ -0,0 +1,246 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// closeColors reports whether a and b differ by at most tolerance in each
+// channel.
+func closeColors(a, b color.RGBA, tolerance int) bool {
+	d := func(x, y uint8) bool { return int(x)-int(y) <= tolerance && int(y)-int(x) <= tolerance }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && d(a.A, b.A)
+}
+
+func TestGGRRoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		ng        NamedGradient
+		tolerance int
+	}{
+		{NamedGradient{"Sunrise", Gradient{Stops: []Stop{
+			{Position: 0, Color: Black, Easing: EaseInOut},
+			{Position: 0.3, Color: color.RGBA{0xFF, 0x80, 0x00, 0xFF}},
+			{Position: 0.7, Color: White, Easing: EaseIn},
+		}}}, 1},
+		// Written as short RGB segments.
+		{NamedGradient{"Rainbow", CyclicGradient([]color.RGBA{Red, Green, Blue}, HSVSpace)}, 6},
+	} {
+		var buf bytes.Buffer
+		if err := WriteGGR(&buf, c.ng); err != nil {
+			t.Fatalf("WriteGGR(%s): %v", c.ng.Name, err)
+		}
+		got, err := ReadGGR(&buf)
+		if err != nil {
+			t.Fatalf("ReadGGR(%s): %v", c.ng.Name, err)
+		}
+		if got.Name != c.ng.Name {
+			t.Errorf("name %q, want %q", got.Name, c.ng.Name)
+		}
+		for i := 0; i < 100; i++ {
+			f := float64(i) / 100
+			if a, b := got.At(f), c.ng.At(f); !closeColors(a, b, c.tolerance) {
+				t.Errorf("%s At(%g) = %v, want %v", c.ng.Name, f, a, b)
+			}
+		}
+	}
+}
+
+func TestReadGGR(t *testing.T) {
+	const ggr = `GIMP Gradient
+Name: Fade
+2
+0 0.25 0.5 0 0 0 1 1 1 1 1 0 0
+0.5 0.75 1 1 0 0 1 0 0 1 1 2 1
+`
+	ng, err := ReadGGR(strings.NewReader(ggr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ng.Name != "Fade" || ng.Space != RGBSpace {
+		t.Errorf("got %q in %v, want \"Fade\" in RGB", ng.Name, ng.Space)
+	}
+	for _, c := range []struct {
+		t    float64
+		want color.RGBA
+	}{
+		{0, Black},
+		{0.25, color.RGBA{0x80, 0x80, 0x80, 0xFF}},
+		{0.5, Red},
+		{0.999, Blue},
+	} {
+		if got := ng.At(c.t); !closeColors(got, c.want, 1) {
+			t.Errorf("At(%g) = %v, want %v", c.t, got, c.want)
+		}
+	}
+
+	// A midpoint off the center reaches the halfway color there.
+	ng, err = ReadGGR(strings.NewReader("GIMP Gradient\n1\n0 0.1 1 0 0 0 1 1 1 1 1 0 0\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ng.At(0.1); !closeColors(got, color.RGBA{0x80, 0x80, 0x80, 0xFF}, 1) {
+		t.Errorf("At(0.1) = %v, want grey at the midpoint", got)
+	}
+
+	// Segments that all blend in HSV make an HSV gradient.
+	ng, err = ReadGGR(strings.NewReader("GIMP Gradient\n1\n0 0.5 1 1 0 0 1 0 0 1 1 0 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ng.Name != "" || ng.Space != HSVSpace {
+		t.Errorf("got %q in %v, want no name in HSV", ng.Name, ng.Space)
+	}
+}
+
+func TestReadGGRMalformed(t *testing.T) {
+	const segment = "0 0.5 1 0 0 0 1 1 1 1 1 0 0\n"
+	for _, c := range []struct {
+		name, ggr string
+	}{
+		{"empty", ""},
+		{"wrong header", "GIMP Palette\n1\n" + segment},
+		{"no count", "GIMP Gradient\nName: x\n"},
+		{"bad count", "GIMP Gradient\nmany\n" + segment},
+		{"no segments", "GIMP Gradient\n0\n"},
+		{"negative count", "GIMP Gradient\n-1\n"},
+		{"truncated", "GIMP Gradient\n2\n" + segment},
+		{"too few fields", "GIMP Gradient\n1\n0 0.5 1 0 0 0 1\n"},
+		{"bad number", "GIMP Gradient\n1\n0 0.5 1 0 zero 0 1 1 1 1 1 0 0\n"},
+		{"bad blending", "GIMP Gradient\n1\n0 0.5 1 0 0 0 1 1 1 1 1 sine 0\n"},
+	} {
+		if _, err := ReadGGR(strings.NewReader(c.ggr)); err == nil {
+			t.Errorf("%s: ReadGGR succeeded", c.name)
+		}
+	}
+	if err := WriteGGR(new(bytes.Buffer), NamedGradient{}); err == nil {
+		t.Error("WriteGGR of an empty gradient succeeded")
+	}
+}
+
+func TestReadUGR(t *testing.T) {
+	const ugr = `Blues {
+gradient:
+  title="Deep blue" smooth=no rotation=100
+  index=0 color=16711680
+  index=200 color=255
+opacity:
+  smooth=no index=0 opacity=255
+}
+
+Plain {
+gradient:
+  index=0 color=0
+}
+`
+	gradients, err := ReadUGR(strings.NewReader(ugr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gradients) != 2 {
+		t.Fatalf("got %d gradients, want 2", len(gradients))
+	}
+	if gradients[0].Name != "Deep blue" || gradients[1].Name != "Plain" {
+		t.Errorf("names %q and %q, want \"Deep blue\" and \"Plain\"", gradients[0].Name, gradients[1].Name)
+	}
+	// The rotation moves index 0 to a quarter of the way.
+	g := gradients[0]
+	for _, c := range []struct {
+		t    float64
+		want color.RGBA
+	}{
+		{0.25, Blue},
+		{0.75, Red},
+	} {
+		if got := g.At(c.t); got != c.want {
+			t.Errorf("At(%g) = %v, want %v", c.t, got, c.want)
+		}
+	}
+}
+
+func TestReadUGRMalformed(t *testing.T) {
+	for _, c := range []struct {
+		name, ugr string
+	}{
+		{"empty", ""},
+		{"no colors", "A {\ngradient:\n  title=\"A\"\n}\n"},
+		{"unterminated", "A {\ngradient:\n  index=0 color=0\n"},
+		{"nested", "A {\nB {\n}\n}\n"},
+		{"unexpected brace", "}\n"},
+		{"bad index", "A {\ngradient:\n  index=first color=0\n}\n"},
+		{"bad color", "A {\ngradient:\n  index=0 color=-1\n}\n"},
+		{"bad rotation", "A {\ngradient:\n  rotation=half\n  index=0 color=0\n}\n"},
+	} {
+		if _, err := ReadUGR(strings.NewReader(c.ugr)); err == nil {
+			t.Errorf("%s: ReadUGR succeeded", c.name)
+		}
+	}
+}
+
+func TestMapRoundTrip(t *testing.T) {
+	p := make(Palette, mapSize)
+	for i := range p {
+		p[i] = color.RGBA{uint8(i), uint8(255 - i), uint8(i * 7), 0xFF}
+	}
+	var buf bytes.Buffer
+	if err := WriteMap(&buf, p); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadMap(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(p) {
+		t.Fatalf("got %d entries, want %d", len(got), len(p))
+	}
+	for i := range p {
+		if got[i] != p[i] {
+			t.Errorf("entry %d = %v, want %v", i, got[i], p[i])
+		}
+	}
+
+	// Other sizes are spread over the 256 entries.
+	buf.Reset()
+	if err := WriteMap(&buf, Palette{Black, White}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = ReadMap(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != mapSize || got[127] != Black || got[128] != White {
+		t.Errorf("got %d entries with %v and %v in the middle, want %d black then white",
+			len(got), got[127], got[128], mapSize)
+	}
+}
+
+func TestReadMap(t *testing.T) {
+	p, err := ReadMap(strings.NewReader("0 0 0 black\n\n255 128 0 orange, by hand\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Palette{Black, {0xFF, 0x80, 0x00, 0xFF}}
+	if len(p) != len(want) || p[0] != want[0] || p[1] != want[1] {
+		t.Errorf("got %v, want %v", p, want)
+	}
+
+	for _, c := range []struct {
+		name, m string
+	}{
+		{"empty", ""},
+		{"blank", "\n \n"},
+		{"too few channels", "0 0\n"},
+		{"bad number", "0 x 0\n"},
+		{"out of range", "0 256 0\n"},
+	} {
+		if _, err := ReadMap(strings.NewReader(c.m)); err == nil {
+			t.Errorf("%s: ReadMap succeeded", c.name)
+		}
+	}
+	if err := WriteMap(new(bytes.Buffer), nil); err == nil {
+		t.Error("WriteMap of an empty palette succeeded")
+	}
+}
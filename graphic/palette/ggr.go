@@ -0,0 +1,213 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// NamedGradient is a gradient with the name it was stored under.
+type NamedGradient struct {
+	Name string
+	Gradient
+}
+
+// GIMP gradient segment blending functions.
+const (
+	ggrLinear = iota
+	ggrCurved
+	ggrSine
+	ggrSphereIncreasing
+	ggrSphereDecreasing
+)
+
+// GIMP gradient segment coloring types.
+const (
+	ggrRGB = iota
+	ggrHSVCounterClockwise
+	ggrHSVClockwise
+)
+
+// ggrSegmentsPerStop is how finely gradients in other spaces than RGB are
+// sampled when written as a GIMP gradient.
+const ggrSegmentsPerStop = 32
+
+// ReadGGR reads a GIMP .ggr gradient. Each segment becomes stops at its
+// ends and at its midpoint if that is off the center. Curved blending is approximated as linear and
+// the sine and sphere blendings by the closest easing. Segments blended in
+// HSV make the whole gradient interpolate in HSV.
+func ReadGGR(r io.Reader) (NamedGradient, error) {
+	var ng NamedGradient
+	scanner := bufio.NewScanner(r)
+	if !scanner.Scan() || strings.TrimSpace(scanner.Text()) != "GIMP Gradient" {
+		return ng, fmt.Errorf("palette: not a GIMP gradient")
+	}
+	if !scanner.Scan() {
+		return ng, fmt.Errorf("palette: ggr: missing segment count")
+	}
+	line := strings.TrimSpace(scanner.Text())
+	if strings.HasPrefix(line, "Name:") {
+		ng.Name = strings.TrimSpace(strings.TrimPrefix(line, "Name:"))
+		if !scanner.Scan() {
+			return ng, fmt.Errorf("palette: ggr: missing segment count")
+		}
+		line = strings.TrimSpace(scanner.Text())
+	}
+	count, err := strconv.Atoi(line)
+	if err != nil {
+		return ng, fmt.Errorf("palette: ggr: segment count: %v", err)
+	}
+	if count < 1 {
+		return ng, fmt.Errorf("palette: ggr: %d segments", count)
+	}
+
+	hsv := true
+	var stops []Stop
+	for i := 0; i < count; i++ {
+		if !scanner.Scan() {
+			return ng, fmt.Errorf("palette: ggr: expected %d segments, got %d", count, i)
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 11 {
+			return ng, fmt.Errorf("palette: ggr segment %d: too few fields", i)
+		}
+		v := make([]float64, 11)
+		for j := range v {
+			if v[j], err = strconv.ParseFloat(fields[j], 64); err != nil {
+				return ng, fmt.Errorf("palette: ggr segment %d: %v", i, err)
+			}
+		}
+		blending, coloring := ggrLinear, ggrRGB
+		if len(fields) >= 13 {
+			if blending, err = strconv.Atoi(fields[11]); err != nil {
+				return ng, fmt.Errorf("palette: ggr segment %d: blending: %v", i, err)
+			}
+			if coloring, err = strconv.Atoi(fields[12]); err != nil {
+				return ng, fmt.Errorf("palette: ggr segment %d: coloring: %v", i, err)
+			}
+		}
+		if coloring == ggrRGB {
+			hsv = false
+		}
+
+		left, mid, right := v[0], v[1], v[2]
+		leftColor := floatColor(v[3], v[4], v[5], v[6])
+		rightColor := floatColor(v[7], v[8], v[9], v[10])
+		easing := ggrEasing(blending)
+		stops = append(stops, Stop{left, leftColor, easing})
+		// A midpoint off the center bends the blend; a stop there with the
+		// halfway color keeps the bend.
+		if mid > left && mid < right && math.Abs(mid-(left+right)/2) > 1e-6 {
+			midColor := interpolateColors(leftColor, rightColor, 0.5)
+			stops = append(stops, Stop{mid, midColor, easing})
+		}
+		// A sharp edge where the next segment starts with another color.
+		if right >= 1 {
+			right = math.Nextafter(1, 0)
+		}
+		stops = append(stops, Stop{right, rightColor, Linear})
+	}
+	if err := scanner.Err(); err != nil {
+		return ng, err
+	}
+
+	ng.Stops = stops
+	if hsv {
+		ng.Space = HSVSpace
+	}
+	return ng, nil
+}
+
+func ggrEasing(blending int) Easing {
+	switch blending {
+	case ggrSine:
+		return EaseInOut
+	case ggrSphereIncreasing:
+		return EaseOut
+	case ggrSphereDecreasing:
+		return EaseIn
+	}
+	return Linear
+}
+
+func floatColor(r, g, b, a float64) color.RGBA {
+	return color.RGBA{toByte(r), toByte(g), toByte(b), toByte(a)}
+}
+
+// WriteGGR writes the gradient as a GIMP .ggr gradient. Gradients in other
+// spaces than RGB are written as many short RGB segments.
+func WriteGGR(w io.Writer, ng NamedGradient) error {
+	p := ng.prepare()
+	if len(p.stops) == 0 {
+		return fmt.Errorf("palette: empty gradient")
+	}
+
+	type segment struct {
+		left, right float64
+		easing      Easing
+	}
+	var segments []segment
+	if ng.Space == RGBSpace {
+		positions := []float64{0}
+		for _, s := range p.stops {
+			if s.Position > positions[len(positions)-1] {
+				positions = append(positions, s.Position)
+			}
+		}
+		positions = append(positions, 1)
+		for i := 0; i+1 < len(positions); i++ {
+			segments = append(segments, segment{positions[i], positions[i+1], p.easingAt(positions[i])})
+		}
+	} else {
+		n := ggrSegmentsPerStop * len(p.stops)
+		for i := 0; i < n; i++ {
+			segments = append(segments, segment{float64(i) / float64(n), float64(i+1) / float64(n), Linear})
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "GIMP Gradient")
+	fmt.Fprintf(bw, "Name: %s\n", ng.Name)
+	fmt.Fprintln(bw, len(segments))
+	for _, s := range segments {
+		lc := p.at(s.left)
+		// The color just before the right end, so that sharp edges at the
+		// end of a segment are kept.
+		rc := p.at(math.Nextafter(s.right, s.left))
+		fmt.Fprintf(bw, "%f %f %f %f %f %f %f %f %f %f %f %d %d\n",
+			s.left, (s.left+s.right)/2, s.right,
+			float64(lc.R)/255, float64(lc.G)/255, float64(lc.B)/255, float64(lc.A)/255,
+			float64(rc.R)/255, float64(rc.G)/255, float64(rc.B)/255, float64(rc.A)/255,
+			ggrBlending(s.easing), ggrRGB)
+	}
+	return bw.Flush()
+}
+
+func ggrBlending(e Easing) int {
+	switch e {
+	case EaseInOut:
+		return ggrSine
+	case EaseOut:
+		return ggrSphereIncreasing
+	case EaseIn:
+		return ggrSphereDecreasing
+	}
+	return ggrLinear
+}
+
+// easingAt is the easing of the segment starting at position t.
+func (p *preparedGradient) easingAt(t float64) Easing {
+	for i := len(p.stops) - 1; i >= 0; i-- {
+		if p.stops[i].Position <= t {
+			return p.stops[i].Easing
+		}
+	}
+	return p.stops[len(p.stops)-1].Easing
+}
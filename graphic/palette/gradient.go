@@ -0,0 +1,186 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// Easing shapes a transition, such as from a gradient stop to the next one.
+type Easing int
+
+const (
+	Linear Easing = iota
+	EaseIn
+	EaseOut
+	EaseInOut
+)
+
+var easingNames = []string{"Linear", "Ease in", "Ease out", "Ease in-out"}
+
+func (e Easing) String() string {
+	if e < 0 || int(e) >= len(easingNames) {
+		return fmt.Sprintf("Easing(%d)", int(e))
+	}
+	return easingNames[e]
+}
+
+// ParseEasing returns the easing with the given name.
+func ParseEasing(name string) (Easing, error) {
+	for i, n := range easingNames {
+		if n == name {
+			return Easing(i), nil
+		}
+	}
+	return 0, fmt.Errorf("palette: unknown easing %q", name)
+}
+
+// Apply maps the linear fraction f, 0 <= f <= 1, through the easing curve.
+func (e Easing) Apply(f float64) float64 {
+	switch e {
+	case EaseIn:
+		return f * f
+	case EaseOut:
+		return 1 - (1-f)*(1-f)
+	case EaseInOut:
+		return f * f * (3 - 2*f)
+	}
+	return f
+}
+
+// Stop is a color at a position of a gradient. Easing shapes the
+// transition towards the next stop.
+type Stop struct {
+	Position float64 // 0 <= Position < 1
+	Color    color.RGBA
+	Easing   Easing
+}
+
+// Gradient is a cyclic color gradient: after the last stop it wraps around
+// to the first one.
+type Gradient struct {
+	Stops []Stop
+	Space Space
+}
+
+// CyclicGradient places the colors at even distances in a gradient.
+func CyclicGradient(colors []color.RGBA, space Space) Gradient {
+	stops := make([]Stop, len(colors))
+	for i, c := range colors {
+		stops[i] = Stop{Position: float64(i) / float64(len(colors)), Color: c}
+	}
+	return Gradient{stops, space}
+}
+
+// Gradient approximates the palette by a gradient of n evenly spaced stops.
+func (p Palette) Gradient(n int) Gradient {
+	if n > len(p) {
+		n = len(p)
+	}
+	stops := make([]Stop, n)
+	for i := range stops {
+		stops[i] = Stop{Position: float64(i) / float64(n), Color: p[i*len(p)/n]}
+	}
+	return Gradient{stops, RGBSpace}
+}
+
+// At returns the color of the gradient at t. The gradient repeats with
+// period 1.
+func (g Gradient) At(t float64) color.RGBA {
+	return g.prepare().at(t)
+}
+
+// Palette samples the gradient at size evenly spaced positions.
+func (g Gradient) Palette(size int) Palette {
+	p := g.prepare()
+	palette := make(Palette, size)
+	for i := range palette {
+		palette[i] = p.at(float64(i) / float64(size))
+	}
+	return palette
+}
+
+// preparedGradient holds the stops of a gradient sorted and converted to
+// its color space.
+type preparedGradient struct {
+	space  Space
+	stops  []Stop
+	coords [][3]float64
+}
+
+func (g Gradient) prepare() *preparedGradient {
+	stops := make([]Stop, len(g.Stops))
+	copy(stops, g.Stops)
+	for i := range stops {
+		stops[i].Position -= math.Floor(stops[i].Position)
+	}
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].Position < stops[j].Position })
+	coords := make([][3]float64, len(stops))
+	for i, s := range stops {
+		coords[i] = g.Space.fromRGB(s.Color)
+	}
+	return &preparedGradient{g.Space, stops, coords}
+}
+
+func (p *preparedGradient) at(t float64) color.RGBA {
+	n := len(p.stops)
+	switch n {
+	case 0:
+		return Black
+	case 1:
+		return p.stops[0].Color
+	}
+	t -= math.Floor(t)
+
+	// Find the stop at or before t; before the first stop the segment is
+	// the one wrapping around from the last stop.
+	i := sort.Search(n, func(i int) bool { return p.stops[i].Position > t }) - 1
+	if i < 0 {
+		i = n - 1
+	}
+	j := (i + 1) % n
+	start, end := p.stops[i].Position, p.stops[j].Position
+	if j == 0 {
+		end++
+	}
+	if t < start {
+		t++
+	}
+	// Stops at the same position give a sharp edge.
+	f := 1.0
+	if end > start {
+		f = p.stops[i].Easing.Apply((t - start) / (end - start))
+	}
+
+	return p.interpolate(i, j, f)
+}
+
+// interpolate mixes the stops i and j in the color space of the gradient,
+// 0 <= f <= 1.
+func (p *preparedGradient) interpolate(i, j int, f float64) color.RGBA {
+	a, b := p.coords[i], p.coords[j]
+	var mix [3]float64
+	for k := range mix {
+		mix[k] = a[k]*(1-f) + b[k]*f
+	}
+	if h := p.space.hueIndex(); h >= 0 {
+		// A grey has no hue of its own; keep the hue of the other stop.
+		if a[1] == 0 {
+			a[h] = b[h]
+		} else if b[1] == 0 {
+			b[h] = a[h]
+		}
+		// Take the shortest way around the hue circle.
+		d := b[h] - a[h]
+		d -= math.Floor(d + 0.5)
+		mix[h] = a[h] + d*f
+		mix[h] -= math.Floor(mix[h])
+	}
+	c := p.space.toRGB(mix)
+	c.A = uint8(float64(p.stops[i].Color.A)*(1-f) + float64(p.stops[j].Color.A)*f + 0.5)
+	return c
+}
@@ -0,0 +1,162 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestEasing(t *testing.T) {
+	for _, c := range []struct {
+		e       Easing
+		f, want float64
+	}{
+		{Linear, 0.3, 0.3},
+		{EaseIn, 0.5, 0.25},
+		{EaseOut, 0.5, 0.75},
+		{EaseInOut, 0.25, 0.15625},
+		{EaseInOut, 0.5, 0.5},
+	} {
+		if got := c.e.Apply(c.f); math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("%v.Apply(%g) = %g, want %g", c.e, c.f, got, c.want)
+		}
+	}
+	for _, e := range []Easing{Linear, EaseIn, EaseOut, EaseInOut} {
+		if e.Apply(0) != 0 || e.Apply(1) != 1 {
+			t.Errorf("%v does not run from 0 to 1", e)
+		}
+		if got, err := ParseEasing(e.String()); err != nil || got != e {
+			t.Errorf("ParseEasing(%q) = %v, %v", e.String(), got, err)
+		}
+	}
+	if _, err := ParseEasing("Bounce"); err == nil {
+		t.Error("ParseEasing(\"Bounce\") succeeded")
+	}
+}
+
+func TestGradientStops(t *testing.T) {
+	g := Gradient{Stops: []Stop{
+		{Position: 0.5, Color: White},
+		{Position: 0, Color: Black},
+	}}
+	for _, c := range []struct {
+		t    float64
+		want color.RGBA
+	}{
+		{0, Black},
+		{0.5, White},
+		{1, Black},
+		{-0.5, White},
+		{0.25, color.RGBA{0x80, 0x80, 0x80, 0xFF}},
+		// Wrapping around from the last stop to the first.
+		{0.75, color.RGBA{0x80, 0x80, 0x80, 0xFF}},
+	} {
+		if got := g.At(c.t); got != c.want {
+			t.Errorf("At(%g) = %v, want %v", c.t, got, c.want)
+		}
+	}
+
+	// The stop positions, not their number, set the segment lengths.
+	g = Gradient{Stops: []Stop{{Position: 0, Color: Black}, {Position: 0.2, Color: White}, {Position: 0.4, Color: Black}}}
+	if got := g.At(0.1); got != (color.RGBA{0x80, 0x80, 0x80, 0xFF}) {
+		t.Errorf("At(0.1) = %v, want grey", got)
+	}
+	if got := g.At(0.3); got != (color.RGBA{0x80, 0x80, 0x80, 0xFF}) {
+		t.Errorf("At(0.3) = %v, want grey on the way back to black", got)
+	}
+	// The last segment, from 0.4 around to 1, is black to black.
+	if got := g.At(0.7); got != Black {
+		t.Errorf("At(0.7) = %v, want black", got)
+	}
+}
+
+func TestGradientEasing(t *testing.T) {
+	g := Gradient{Stops: []Stop{{Position: 0, Color: Black, Easing: EaseIn}, {Position: 0.5, Color: White}}}
+	if got := g.At(0.25); got != (color.RGBA{0x40, 0x40, 0x40, 0xFF}) {
+		t.Errorf("eased At(0.25) = %v, want a quarter of white", got)
+	}
+}
+
+func TestGradientSharpEdge(t *testing.T) {
+	g := Gradient{Stops: []Stop{
+		{Position: 0, Color: Black},
+		{Position: 0.5, Color: Black},
+		{Position: 0.5, Color: White},
+	}}
+	if got := g.At(0.49); got != Black {
+		t.Errorf("At(0.49) = %v, want black", got)
+	}
+	if got := g.At(0.5); got != White {
+		t.Errorf("At(0.5) = %v, want white", got)
+	}
+}
+
+// hue returns the HSV hue of c.
+func hue(c color.RGBA) float64 {
+	h, _, _ := ToHSV(c)
+	return h
+}
+
+func TestGradientShortestHue(t *testing.T) {
+	// Hues 0.9 and 0.1 are 0.2 apart through red, 0.8 through cyan.
+	magenta := HSV(0.9, 1, 1)
+	orange := HSV(0.1, 1, 1)
+	for _, sp := range []Space{HSVSpace, HCLSpace} {
+		g := Gradient{Stops: []Stop{{Position: 0, Color: magenta}, {Position: 0.5, Color: orange}}, Space: sp}
+		for _, f := range []float64{0.1, 0.2, 0.25, 0.3, 0.4} {
+			if h := hue(g.At(f)); h > 0.15 && h < 0.85 {
+				t.Errorf("%v: hue %g at %g takes the long way round", sp, h, f)
+			}
+		}
+		// The way back from orange to magenta also passes red.
+		for _, f := range []float64{0.6, 0.75, 0.9} {
+			if h := hue(g.At(f)); h > 0.15 && h < 0.85 {
+				t.Errorf("%v: hue %g at %g takes the long way round", sp, h, f)
+			}
+		}
+	}
+
+	// Without wrapping, the hue passes the colors between.
+	g := Gradient{Stops: []Stop{{Position: 0, Color: HSV(0.2, 1, 1)}, {Position: 0.5, Color: HSV(0.6, 1, 1)}}, Space: HSVSpace}
+	if h := hue(g.At(0.25)); math.Abs(h-0.4) > 0.01 {
+		t.Errorf("hue %g halfway from 0.2 to 0.6, want 0.4", h)
+	}
+}
+
+func TestGradientGreyKeepsHue(t *testing.T) {
+	// Blending to grey fades the saturation without turning through red.
+	g := Gradient{Stops: []Stop{{Position: 0, Color: Blue}, {Position: 0.5, Color: White}}, Space: HSVSpace}
+	if h := hue(g.At(0.2)); math.Abs(h-2.0/3) > 0.01 {
+		t.Errorf("hue %g on the way from blue to white, want blue", h)
+	}
+}
+
+func TestGradientOKLabMidpoint(t *testing.T) {
+	// Perceptual spaces lighten the midpoint of black and white to a
+	// mid grey, where sRGB bytes would give 0x80.
+	g := Gradient{Stops: []Stop{{Position: 0, Color: Black}, {Position: 0.5, Color: White}}, Space: OKLabSpace}
+	mid := g.At(0.25)
+	lab := OKLabSpace.fromRGB(mid)
+	if math.Abs(lab[0]-0.5) > 0.01 || mid.R != mid.G || mid.G != mid.B {
+		t.Errorf("OKLab midpoint %v with lightness %g, want a grey of lightness 0.5", mid, lab[0])
+	}
+	if lin := (Gradient{Stops: g.Stops, Space: LinearRGBSpace}).At(0.25); lin.R <= mid.R {
+		t.Errorf("linear RGB midpoint %v, want lighter than OKLab %v", lin, mid)
+	}
+}
+
+func TestCyclicGradient(t *testing.T) {
+	g := CyclicGradient([]color.RGBA{Red, Green, Blue}, RGBSpace)
+	for i, want := range []color.RGBA{Red, Green, Blue} {
+		if got := g.At(float64(i) / 3); got != want {
+			t.Errorf("At(%d/3) = %v, want %v", i, got, want)
+		}
+	}
+	p := g.Palette(6)
+	if len(p) != 6 || p[0] != Red || p[2] != Green || p[4] != Blue {
+		t.Errorf("Palette(6) = %v", p)
+	}
+}
@@ -0,0 +1,80 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"image/color"
+	"math"
+)
+
+// HSV converts a hue, saturation and value to an opaque color.
+// 0 <= h < 1, 0 <= s, v <= 1
+func HSV(h, s, v float64) color.RGBA {
+	r, g, b := HSVToRGB(h, s, v)
+	return color.RGBA{toByte(r), toByte(g), toByte(b), 0xFF}
+}
+
+// ToHSV converts a color to hue, saturation and value, all in [0, 1].
+func ToHSV(c color.RGBA) (h, s, v float64) {
+	return RGBToHSV(float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+}
+
+// HSVToRGB is HSV with the channels of the color in [0, 1].
+func HSVToRGB(h, s, v float64) (r, g, b float64) {
+	h = (h - math.Floor(h)) * 6
+	i := math.Floor(h)
+	f := h - i
+	p := v * (1 - s)
+	q := v * (1 - s*f)
+	t := v * (1 - s*(1-f))
+	switch int(i) % 6 {
+	case 0:
+		return v, t, p
+	case 1:
+		return q, v, p
+	case 2:
+		return p, v, t
+	case 3:
+		return p, q, v
+	case 4:
+		return t, p, v
+	}
+	return v, p, q
+}
+
+// RGBToHSV is ToHSV of a color with channels in [0, 1].
+func RGBToHSV(r, g, b float64) (h, s, v float64) {
+	hi := math.Max(r, math.Max(g, b))
+	lo := math.Min(r, math.Min(g, b))
+	v = hi
+	d := hi - lo
+	if hi == 0 || d == 0 {
+		return 0, 0, v
+	}
+	s = d / hi
+	switch hi {
+	case r:
+		h = (g - b) / d
+	case g:
+		h = 2 + (b-r)/d
+	default:
+		h = 4 + (r-g)/d
+	}
+	h /= 6
+	if h < 0 {
+		h++
+	}
+	return h, s, v
+}
+
+// toByte converts a channel value in [0, 1] to a byte, clamping outside values.
+func toByte(x float64) uint8 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 0xFF
+	}
+	return uint8(x*255 + 0.5)
+}
@@ -0,0 +1,64 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// mapSize is the number of entries of a Fractint palette.
+const mapSize = 256
+
+// ReadMap reads a Fractint or ChaosPro .map palette: one "R G B" line per
+// entry, where anything after the third number is a comment.
+func ReadMap(r io.Reader) (Palette, error) {
+	var p Palette
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("palette: map line %d: expected three channels", line)
+		}
+		var rgb [3]uint8
+		for i := range rgb {
+			v, err := strconv.ParseUint(fields[i], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("palette: map line %d: %v", line, err)
+			}
+			rgb[i] = uint8(v)
+		}
+		p = append(p, color.RGBA{rgb[0], rgb[1], rgb[2], 0xFF})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("palette: empty map")
+	}
+	return p, nil
+}
+
+// WriteMap writes the palette as a 256 entry .map palette, picking evenly
+// spaced entries if the palette has another size.
+func WriteMap(w io.Writer, p Palette) error {
+	if len(p) == 0 {
+		return fmt.Errorf("palette: empty palette")
+	}
+	bw := bufio.NewWriter(w)
+	for i := 0; i < mapSize; i++ {
+		c := p[i*len(p)/mapSize]
+		fmt.Fprintf(bw, "%d %d %d\n", c.R, c.G, c.B)
+	}
+	return bw.Flush()
+}
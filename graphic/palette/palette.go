@@ -3,7 +3,12 @@
 
 package palette
 
-import "image/color"
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
 
 type Palette []color.RGBA
 
@@ -26,6 +31,7 @@ var (
 
 // CyclicPalette generates a cyclic gradient palette of the given colors.
 // Each two consequential colors are interpolated.
+// See Gradient for interpolation in other color spaces.
 func CyclicPalette(colors []color.RGBA) Palette {	
 	palette := make([]color.RGBA, 256 * len(colors))		
 	pIdx := 0
@@ -92,3 +98,45 @@ func interpolateColors(c1, c2 color.RGBA, f float64) color.RGBA {
 		uint8(float64(c1.B)*(1.0-f) + float64(c2.B)*f),
 		uint8(float64(c1.A)*(1.0-f) + float64(c2.A)*f)}
 }
+
+// Hex formats a color as RRGGBBAA in hexadecimal.
+func Hex(c color.RGBA) string {
+	return fmt.Sprintf("%02X%02X%02X%02X", c.R, c.G, c.B, c.A)
+}
+
+// ParseHex parses a color formatted as RRGGBB or RRGGBBAA in hexadecimal,
+// optionally preceded by #.
+func ParseHex(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 6 {
+		s += "FF"
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 8 {
+		return color.RGBA{}, fmt.Errorf("palette: invalid color %q", s)
+	}
+	return color.RGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// MarshalText encodes the palette as space separated hexadecimal colors.
+func (p Palette) MarshalText() ([]byte, error) {
+	hex := make([]string, len(p))
+	for i, c := range p {
+		hex[i] = Hex(c)
+	}
+	return []byte(strings.Join(hex, " ")), nil
+}
+
+func (p *Palette) UnmarshalText(text []byte) error {
+	fields := strings.Fields(string(text))
+	palette := make(Palette, len(fields))
+	for i, f := range fields {
+		c, err := ParseHex(f)
+		if err != nil {
+			return err
+		}
+		palette[i] = c
+	}
+	*p = palette
+	return nil
+}
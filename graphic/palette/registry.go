@@ -0,0 +1,163 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GradientSize is the number of entries of palettes sampled from gradients.
+const GradientSize = 1024
+
+// Registry holds named palettes and colors in the order they were added.
+type Registry struct {
+	paletteNames []string
+	palettes     map[string]Palette
+	gradients    map[string]Gradient
+	colorNames   []string
+	colors       map[string]color.RGBA
+}
+
+// NewRegistry returns a registry holding the built-in palettes and colors.
+func NewRegistry() *Registry {
+	r := &Registry{
+		palettes:  make(map[string]Palette),
+		gradients: make(map[string]Gradient),
+		colors:    make(map[string]color.RGBA),
+	}
+	r.AddPalette("Peach", CyclicPalette([]color.RGBA{Orange, White, OrangeRed, Red}))
+	r.AddGradient("Banana", CyclicGradient([]color.RGBA{Gold, DarkYellow, White, Orange}, OKLabSpace))
+	r.AddGradient("Apple", CyclicGradient([]color.RGBA{DarkGreen, DarkYellow, Red, MistyRose}, OKLabSpace))
+	r.AddGradient("Ocean", CyclicGradient([]color.RGBA{Blue, PaleGreyBlue, White, Cyan}, OKLabSpace))
+	r.AddGradient("Rainbow", CyclicGradient([]color.RGBA{Red, Gold, Green, Cyan, Blue, Purple}, HCLSpace))
+
+	r.AddColor("Black", Black)
+	r.AddColor("White", White)
+	r.AddColor("Orange red", OrangeRed)
+	r.AddColor("Orange", Orange)
+	r.AddColor("Gold", Gold)
+	r.AddColor("Dark yellow", DarkYellow)
+	r.AddColor("Dark green", DarkGreen)
+	r.AddColor("Pale grey blue", PaleGreyBlue)
+	r.AddColor("Purple", Purple)
+	r.AddColor("Cyan", Cyan)
+	r.AddColor("Red", Red)
+	r.AddColor("Green", Green)
+	r.AddColor("Blue", Blue)
+	r.AddColor("Misty rose", MistyRose)
+	return r
+}
+
+// AddPalette adds or replaces a named palette.
+func (r *Registry) AddPalette(name string, p Palette) {
+	if _, ok := r.palettes[name]; !ok {
+		r.paletteNames = append(r.paletteNames, name)
+	}
+	r.palettes[name] = p
+	delete(r.gradients, name)
+}
+
+// AddGradient adds or replaces a named palette sampled from a gradient.
+// The gradient is kept so that it can be edited.
+func (r *Registry) AddGradient(name string, g Gradient) {
+	r.AddPalette(name, g.Palette(GradientSize))
+	r.gradients[name] = g
+}
+
+// AddColor adds or replaces a named color.
+func (r *Registry) AddColor(name string, c color.RGBA) {
+	if _, ok := r.colors[name]; !ok {
+		r.colorNames = append(r.colorNames, name)
+	}
+	r.colors[name] = c
+}
+
+func (r *Registry) Palette(name string) (Palette, bool) {
+	p, ok := r.palettes[name]
+	return p, ok
+}
+
+// Gradient returns the gradient a palette was sampled from, if any.
+func (r *Registry) Gradient(name string) (Gradient, bool) {
+	g, ok := r.gradients[name]
+	return g, ok
+}
+
+func (r *Registry) Color(name string) (color.RGBA, bool) {
+	c, ok := r.colors[name]
+	return c, ok
+}
+
+func (r *Registry) PaletteNames() []string { return append([]string(nil), r.paletteNames...) }
+func (r *Registry) ColorNames() []string   { return append([]string(nil), r.colorNames...) }
+
+// LoadFile adds the palettes of a .map, .ggr or .ugr file. Map palettes
+// are named after the file, gradients by their own names when they have one.
+func (r *Registry) LoadFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	base := filepath.Base(filename)
+	ext := strings.ToLower(filepath.Ext(base))
+	name := strings.TrimSuffix(base, filepath.Ext(base))
+	switch ext {
+	case ".map":
+		p, err := ReadMap(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		r.AddPalette(name, p)
+	case ".ggr":
+		ng, err := ReadGGR(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		if ng.Name != "" {
+			name = ng.Name
+		}
+		r.AddGradient(name, ng.Gradient)
+	case ".ugr":
+		gradients, err := ReadUGR(file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		for _, ng := range gradients {
+			r.AddGradient(ng.Name, ng.Gradient)
+		}
+	default:
+		return fmt.Errorf("%s: unknown palette format", filename)
+	}
+	return nil
+}
+
+// LoadDir adds the palettes of all palette files in dir. A missing
+// directory is not an error. Loading continues past broken files; the
+// first error is returned.
+func (r *Registry) LoadDir(dir string) error {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var first error
+	for _, info := range infos {
+		switch strings.ToLower(filepath.Ext(info.Name())) {
+		case ".map", ".ggr", ".ugr":
+			if err := r.LoadFile(filepath.Join(dir, info.Name())); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,108 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"image/color"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRegistryAdd(t *testing.T) {
+	r := &Registry{
+		palettes:  make(map[string]Palette),
+		gradients: make(map[string]Gradient),
+		colors:    make(map[string]color.RGBA),
+	}
+	r.AddPalette("A", Palette{Red})
+	r.AddGradient("B", CyclicGradient([]color.RGBA{Red, Blue}, RGBSpace))
+	r.AddPalette("A", Palette{Blue})
+	// Replacing a gradient with a palette forgets the gradient.
+	r.AddPalette("B", Palette{Green})
+	r.AddColor("C", Red)
+	r.AddColor("C", Green)
+
+	if got, want := r.PaletteNames(), []string{"A", "B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PaletteNames() = %v, want %v", got, want)
+	}
+	if got, want := r.ColorNames(), []string{"C"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ColorNames() = %v, want %v", got, want)
+	}
+	if p, _ := r.Palette("A"); !reflect.DeepEqual(p, Palette{Blue}) {
+		t.Errorf("Palette(A) = %v, want %v", p, Palette{Blue})
+	}
+	if _, ok := r.Gradient("B"); ok {
+		t.Error("Gradient(B) kept after AddPalette")
+	}
+	if c, _ := r.Color("C"); c != Green {
+		t.Errorf("Color(C) = %v, want %v", c, Green)
+	}
+	if _, ok := r.Palette("D"); ok {
+		t.Error("Palette(D) found")
+	}
+	r.PaletteNames()[0] = "Z"
+	if r.PaletteNames()[0] != "A" {
+		t.Error("PaletteNames shares its slice")
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "palettes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"fire.map":   "255 0 0\n255 255 0\n",
+		"fade.GGR":   "GIMP Gradient\nName: Fade\n1\n0 0.5 1 0 0 0 1 1 1 1 1 0 0\n",
+		"plain.ggr":  "GIMP Gradient\n1\n0 0.5 1 0 0 0 1 1 1 1 1 0 0\n",
+		"broken.ggr": "GIMP Gradient\n1\n",
+		"two.ugr": `Blues {
+gradient:
+  index=0 color=16711680
+}
+Reds {
+gradient:
+  index=0 color=255
+}
+`,
+		"notes.txt": "not a palette",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewRegistry()
+	builtIn := len(r.PaletteNames())
+	err = r.LoadDir(dir)
+	if err == nil {
+		t.Error("LoadDir succeeded with a broken file")
+	}
+	got := r.PaletteNames()[builtIn:]
+	// ReadDir sorts by name, so upper case comes first.
+	want := []string{"Fade", "fire", "plain", "Blues", "Reds"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded %v, want %v", got, want)
+	}
+	if p, _ := r.Palette("fire"); !reflect.DeepEqual(p, Palette{Red, {0xFF, 0xFF, 0, 0xFF}}) {
+		t.Errorf("fire = %v", p)
+	}
+	if _, ok := r.Gradient("Fade"); !ok {
+		t.Error("Fade has no gradient")
+	}
+	if p, _ := r.Palette("Fade"); len(p) != GradientSize {
+		t.Errorf("Fade has %d entries, want %d", len(p), GradientSize)
+	}
+
+	if err := r.LoadDir(filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("LoadDir of a missing directory: %v", err)
+	}
+	if err := r.LoadFile(filepath.Join(dir, "notes.txt")); err == nil {
+		t.Error("LoadFile of a text file succeeded")
+	}
+}
@@ -0,0 +1,182 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// Space is a color space in which gradient colors are interpolated.
+type Space int
+
+const (
+	RGBSpace       Space = iota // sRGB bytes, the classic look
+	LinearRGBSpace              // light intensities, brighter midpoints
+	OKLabSpace                  // perceptually uniform, no hue drift
+	CIELabSpace                 // perceptually uniform, D65 white point
+	HSVSpace                    // hue, saturation and value
+	HCLSpace                    // hue, chroma and luminance (CIE LCh)
+)
+
+var spaceNames = []string{"RGB", "Linear RGB", "OKLab", "CIELab", "HSV", "HCL"}
+
+func (sp Space) String() string {
+	if sp < 0 || int(sp) >= len(spaceNames) {
+		return fmt.Sprintf("Space(%d)", int(sp))
+	}
+	return spaceNames[sp]
+}
+
+// Spaces lists all color spaces in order.
+func Spaces() []Space {
+	spaces := make([]Space, len(spaceNames))
+	for i := range spaces {
+		spaces[i] = Space(i)
+	}
+	return spaces
+}
+
+// ParseSpace returns the color space with the given name.
+func ParseSpace(name string) (Space, error) {
+	for i, n := range spaceNames {
+		if n == name {
+			return Space(i), nil
+		}
+	}
+	return 0, fmt.Errorf("palette: unknown color space %q", name)
+}
+
+// hueIndex is the index of the cyclic hue coordinate in the space, or -1.
+func (sp Space) hueIndex() int {
+	switch sp {
+	case HSVSpace:
+		return 0
+	case HCLSpace:
+		return 2
+	}
+	return -1
+}
+
+// fromRGB converts c to the coordinates of the space.
+func (sp Space) fromRGB(c color.RGBA) [3]float64 {
+	r, g, b := float64(c.R)/255, float64(c.G)/255, float64(c.B)/255
+	switch sp {
+	case LinearRGBSpace:
+		return [3]float64{linearize(r), linearize(g), linearize(b)}
+	case OKLabSpace:
+		return linearToOKLab(linearize(r), linearize(g), linearize(b))
+	case CIELabSpace:
+		return linearToCIELab(linearize(r), linearize(g), linearize(b))
+	case HSVSpace:
+		h, s, v := RGBToHSV(r, g, b)
+		return [3]float64{h, s, v}
+	case HCLSpace:
+		lab := linearToCIELab(linearize(r), linearize(g), linearize(b))
+		h := math.Atan2(lab[2], lab[1]) / (2 * math.Pi)
+		if h < 0 {
+			h++
+		}
+		return [3]float64{lab[0], math.Hypot(lab[1], lab[2]), h}
+	}
+	return [3]float64{r, g, b}
+}
+
+// toRGB converts coordinates of the space to sRGB channels in [0, 1].
+// Colors outside the sRGB gamut are clamped.
+func (sp Space) toRGB(p [3]float64) color.RGBA {
+	var r, g, b float64
+	switch sp {
+	case LinearRGBSpace:
+		r, g, b = delinearize(p[0]), delinearize(p[1]), delinearize(p[2])
+	case OKLabSpace:
+		r, g, b = okLabToLinear(p)
+		r, g, b = delinearize(r), delinearize(g), delinearize(b)
+	case CIELabSpace:
+		r, g, b = cieLabToLinear(p)
+		r, g, b = delinearize(r), delinearize(g), delinearize(b)
+	case HSVSpace:
+		r, g, b = HSVToRGB(p[0], p[1], p[2])
+	case HCLSpace:
+		h := p[2] * 2 * math.Pi
+		r, g, b = cieLabToLinear([3]float64{p[0], p[1] * math.Cos(h), p[1] * math.Sin(h)})
+		r, g, b = delinearize(r), delinearize(g), delinearize(b)
+	default:
+		r, g, b = p[0], p[1], p[2]
+	}
+	return color.RGBA{toByte(r), toByte(g), toByte(b), 0xFF}
+}
+
+func linearize(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+func delinearize(c float64) float64 {
+	if c <= 0.0031308 {
+		return c * 12.92
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
+
+func linearToOKLab(r, g, b float64) [3]float64 {
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+	return [3]float64{
+		0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s,
+	}
+}
+
+func okLabToLinear(p [3]float64) (r, g, b float64) {
+	l := p[0] + 0.3963377774*p[1] + 0.2158037573*p[2]
+	m := p[0] - 0.1055613458*p[1] - 0.0638541728*p[2]
+	s := p[0] - 0.0894841775*p[1] - 1.2914855480*p[2]
+	l, m, s = l*l*l, m*m*m, s*s*s
+	return 4.0767416621*l - 3.3077115913*m + 0.2309699292*s,
+		-1.2684380046*l + 2.6097574011*m - 0.3413193965*s,
+		-0.0041960863*l - 0.7034186147*m + 1.7076147010*s
+}
+
+// D65 reference white.
+const whiteX, whiteY, whiteZ = 0.95047, 1.0, 1.08883
+
+func linearToCIELab(r, g, b float64) [3]float64 {
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / whiteX
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / whiteY
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / whiteZ
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+func cieLabToLinear(p [3]float64) (r, g, b float64) {
+	fy := (p[0] + 16) / 116
+	x := labFInv(fy+p[1]/500) * whiteX
+	y := labFInv(fy) * whiteY
+	z := labFInv(fy-p[2]/200) * whiteZ
+	return 3.2404542*x - 1.5371385*y - 0.4985314*z,
+		-0.9692660*x + 1.8760108*y + 0.0415560*z,
+		0.0556434*x - 0.2040259*y + 1.0572252*z
+}
+
+const labDelta = 6.0 / 29
+
+func labF(t float64) float64 {
+	if t > labDelta*labDelta*labDelta {
+		return math.Cbrt(t)
+	}
+	return t/(3*labDelta*labDelta) + 4.0/29
+}
+
+func labFInv(t float64) float64 {
+	if t > labDelta {
+		return t * t * t
+	}
+	return 3 * labDelta * labDelta * (t - 4.0/29)
+}
@@ -0,0 +1,70 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func near(a, b [3]float64, eps float64) bool {
+	for k := range a {
+		if math.Abs(a[k]-b[k]) > eps {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSpaceReferenceColors(t *testing.T) {
+	for _, c := range []struct {
+		space Space
+		color color.RGBA
+		want  [3]float64
+		eps   float64
+	}{
+		// OKLab values from Björn Ottosson's reference implementation.
+		{OKLabSpace, White, [3]float64{1, 0, 0}, 1e-4},
+		{OKLabSpace, Black, [3]float64{0, 0, 0}, 1e-9},
+		{OKLabSpace, Red, [3]float64{0.62796, 0.22486, 0.12585}, 1e-4},
+		{OKLabSpace, Green, [3]float64{0.86644, -0.23389, 0.17950}, 1e-4},
+		{OKLabSpace, Blue, [3]float64{0.45201, -0.03246, -0.31153}, 1e-4},
+		// CIELab, D65.
+		{CIELabSpace, White, [3]float64{100, 0, 0}, 1e-2},
+		{CIELabSpace, Red, [3]float64{53.2408, 80.0925, 67.2032}, 1e-2},
+		{CIELabSpace, Blue, [3]float64{32.2970, 79.1875, -107.8602}, 1e-2},
+		{HCLSpace, Red, [3]float64{53.2408, 104.5518, 39.999 / 360}, 1e-2},
+		{HSVSpace, Green, [3]float64{1.0 / 3, 1, 1}, 1e-12},
+		{HSVSpace, color.RGBA{0x80, 0x40, 0x40, 0xFF}, [3]float64{0, 0.5, 0x80 / 255.0}, 1e-12},
+		{LinearRGBSpace, color.RGBA{0xBC, 0x00, 0xFF, 0xFF}, [3]float64{0.5029, 0, 1}, 1e-3},
+		{RGBSpace, color.RGBA{0xFF, 0x00, 0x33, 0xFF}, [3]float64{1, 0, 0.2}, 1e-12},
+	} {
+		if got := c.space.fromRGB(c.color); !near(got, c.want, c.eps) {
+			t.Errorf("%v of %v: %v, want %v", c.space, c.color, got, c.want)
+		}
+	}
+}
+
+func TestSpaceRoundTrip(t *testing.T) {
+	colors := []color.RGBA{Black, White, Red, Green, Blue, OrangeRed, Purple, PaleGreyBlue, {0x7F, 0x7F, 0x7F, 0xFF}, {0x01, 0x02, 0x03, 0xFF}}
+	for _, sp := range Spaces() {
+		for _, c := range colors {
+			if got := sp.toRGB(sp.fromRGB(c)); got != c {
+				t.Errorf("%v: %v converts back to %v", sp, c, got)
+			}
+		}
+	}
+}
+
+func TestParseSpace(t *testing.T) {
+	for _, sp := range Spaces() {
+		if got, err := ParseSpace(sp.String()); err != nil || got != sp {
+			t.Errorf("ParseSpace(%q) = %v, %v", sp.String(), got, err)
+		}
+	}
+	if _, err := ParseSpace("CMYK"); err == nil {
+		t.Error("ParseSpace(\"CMYK\") succeeded")
+	}
+}
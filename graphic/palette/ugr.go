@@ -0,0 +1,124 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package palette
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ugrIndices is the number of positions in an Ultra Fractal gradient.
+const ugrIndices = 400
+
+// ReadUGR reads an Ultra Fractal .ugr gradient collection, which must hold
+// at least one gradient. Colors are interpolated linearly; smooth (spline)
+// interpolation and opacity are not supported.
+func ReadUGR(r io.Reader) ([]NamedGradient, error) {
+	var gradients []NamedGradient
+	var current *NamedGradient
+	var rotation float64
+	section := ""
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+		case strings.HasSuffix(text, "{"):
+			if current != nil {
+				return nil, fmt.Errorf("palette: ugr line %d: nested entry", line)
+			}
+			current = &NamedGradient{Name: strings.TrimSpace(strings.TrimSuffix(text, "{"))}
+			rotation = 0
+			section = ""
+		case text == "}":
+			if current == nil {
+				return nil, fmt.Errorf("palette: ugr line %d: unexpected }", line)
+			}
+			if len(current.Stops) == 0 {
+				return nil, fmt.Errorf("palette: ugr line %d: entry %q has no colors", line, current.Name)
+			}
+			for i := range current.Stops {
+				current.Stops[i].Position += rotation / ugrIndices
+			}
+			gradients = append(gradients, *current)
+			current = nil
+		case strings.HasSuffix(text, ":"):
+			section = strings.TrimSuffix(text, ":")
+		case current != nil && section == "gradient":
+			fields := ugrFields(text)
+			if title, ok := fields["title"]; ok {
+				current.Name = title
+			}
+			if v, ok := fields["rotation"]; ok {
+				var err error
+				if rotation, err = strconv.ParseFloat(v, 64); err != nil {
+					return nil, fmt.Errorf("palette: ugr line %d: rotation: %v", line, err)
+				}
+			}
+			index, hasIndex := fields["index"]
+			value, hasColor := fields["color"]
+			if !hasIndex || !hasColor {
+				continue
+			}
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				return nil, fmt.Errorf("palette: ugr line %d: %v", line, err)
+			}
+			bgr, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("palette: ugr line %d: %v", line, err)
+			}
+			// Colors are stored as 0x00BBGGRR.
+			c := color.RGBA{uint8(bgr), uint8(bgr >> 8), uint8(bgr >> 16), 0xFF}
+			current.Stops = append(current.Stops, Stop{Position: float64(i) / ugrIndices, Color: c})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, fmt.Errorf("palette: ugr: unterminated entry %q", current.Name)
+	}
+	if len(gradients) == 0 {
+		return nil, fmt.Errorf("palette: ugr: no gradients")
+	}
+	return gradients, nil
+}
+
+// ugrFields splits a line of key=value pairs, where values may be quoted.
+func ugrFields(line string) map[string]string {
+	fields := make(map[string]string)
+	for len(line) > 0 {
+		line = strings.TrimLeft(line, " \t")
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			break
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+		var value string
+		if strings.HasPrefix(line, "\"") {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				value, line = line[1:], ""
+			} else {
+				value, line = line[1:end+1], line[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			value, line = line[:end], line[end:]
+		}
+		fields[key] = value
+	}
+	return fields
+}
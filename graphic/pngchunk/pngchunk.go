@@ -0,0 +1,225 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+// Package pngchunk reads and writes PNG files as lists of chunks, so that
+// chunks the standard encoder does not know about can be added.
+package pngchunk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+// Signature starts every PNG file.
+const Signature = "\x89PNG\r\n\x1a\n"
+
+// Chunk is a PNG chunk without its length and checksum.
+type Chunk struct {
+	Type string
+	Data []byte
+}
+
+// Read reads all chunks of a PNG file, checking their checksums.
+func Read(r io.Reader) ([]Chunk, error) {
+	sig := make([]byte, len(Signature))
+	if _, err := io.ReadFull(r, sig); err != nil {
+		return nil, err
+	}
+	if string(sig) != Signature {
+		return nil, errors.New("pngchunk: not a PNG file")
+	}
+	var chunks []Chunk
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("pngchunk: %v", err)
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		chunk := Chunk{Type: string(header[4:8]), Data: make([]byte, length)}
+		if _, err := io.ReadFull(r, chunk.Data); err != nil {
+			return nil, fmt.Errorf("pngchunk: %s: %v", chunk.Type, err)
+		}
+		var crc [4]byte
+		if _, err := io.ReadFull(r, crc[:]); err != nil {
+			return nil, fmt.Errorf("pngchunk: %s: %v", chunk.Type, err)
+		}
+		if binary.BigEndian.Uint32(crc[:]) != chunk.crc() {
+			return nil, fmt.Errorf("pngchunk: %s: checksum mismatch", chunk.Type)
+		}
+		chunks = append(chunks, chunk)
+		if chunk.Type == "IEND" {
+			return chunks, nil
+		}
+	}
+}
+
+// Write writes the PNG signature followed by the chunks.
+func Write(w io.Writer, chunks []Chunk) error {
+	if _, err := io.WriteString(w, Signature); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteChunk writes a single chunk, for streams written chunk by chunk
+// after the signature.
+func WriteChunk(w io.Writer, c Chunk) error {
+	return c.write(w)
+}
+
+func (c Chunk) write(w io.Writer) error {
+	buf := make([]byte, 8, 12+len(c.Data))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(c.Data)))
+	copy(buf[4:8], c.Type)
+	buf = append(buf, c.Data...)
+	buf = buf[:len(buf)+4]
+	binary.BigEndian.PutUint32(buf[len(buf)-4:], c.crc())
+	_, err := w.Write(buf)
+	return err
+}
+
+func (c Chunk) crc() uint32 {
+	h := crc32.NewIEEE()
+	io.WriteString(h, c.Type)
+	h.Write(c.Data)
+	return h.Sum32()
+}
+
+// InsertAfterHeader returns chunks with extra inserted right after IHDR.
+func InsertAfterHeader(chunks []Chunk, extra ...Chunk) []Chunk {
+	result := make([]Chunk, 0, len(chunks)+len(extra))
+	for _, c := range chunks {
+		result = append(result, c)
+		if c.Type == "IHDR" {
+			result = append(result, extra...)
+		}
+	}
+	return result
+}
+
+// headerSize is the length of the signature and the IHDR chunk that start
+// every PNG stream.
+const headerSize = len(Signature) + 12 + 13
+
+// NewInserter returns a writer that copies a PNG stream to w with chunks
+// inserted right after IHDR. Unlike InsertAfterHeader it does not hold the
+// image in memory.
+func NewInserter(w io.Writer, chunks ...Chunk) io.Writer {
+	return &inserter{w: w, chunks: chunks}
+}
+
+type inserter struct {
+	w      io.Writer
+	chunks []Chunk
+	header []byte
+	done   bool
+}
+
+func (in *inserter) Write(p []byte) (int, error) {
+	n := len(p)
+	if !in.done {
+		k := headerSize - len(in.header)
+		if k > len(p) {
+			k = len(p)
+		}
+		in.header = append(in.header, p[:k]...)
+		p = p[k:]
+		if len(in.header) < headerSize {
+			return n, nil
+		}
+		in.done = true
+		if string(in.header[:len(Signature)]) != Signature || string(in.header[12:16]) != "IHDR" {
+			return 0, errors.New("pngchunk: stream does not start with a PNG header")
+		}
+		if _, err := in.w.Write(in.header); err != nil {
+			return 0, err
+		}
+		for _, c := range in.chunks {
+			if err := c.write(in.w); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if _, err := in.w.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Text is a tEXt chunk. Both keyword and text should be Latin-1.
+func Text(keyword, text string) Chunk {
+	return Chunk{"tEXt", []byte(keyword + "\x00" + text)}
+}
+
+// InternationalText is a zlib compressed iTXt chunk with UTF-8 text.
+func InternationalText(keyword, text string) Chunk {
+	var buf bytes.Buffer
+	buf.WriteString(keyword)
+	// Null separator, compression flag and method, empty language tag and
+	// translated keyword.
+	buf.Write([]byte{0, 1, 0, 0, 0})
+	zw := zlib.NewWriter(&buf)
+	io.WriteString(zw, text)
+	zw.Close()
+	return Chunk{"iTXt", buf.Bytes()}
+}
+
+// IsText reports whether c is a tEXt, zTXt or iTXt chunk.
+func (c Chunk) IsText() bool {
+	return c.Type == "tEXt" || c.Type == "zTXt" || c.Type == "iTXt"
+}
+
+// ParseText returns the keyword and text of a text chunk, see IsText.
+func ParseText(c Chunk) (keyword, text string, err error) {
+	if !c.IsText() {
+		return "", "", fmt.Errorf("pngchunk: %s is not a text chunk", c.Type)
+	}
+	i := bytes.IndexByte(c.Data, 0)
+	if i < 0 {
+		return "", "", fmt.Errorf("pngchunk: %s: missing keyword separator", c.Type)
+	}
+	keyword, rest := string(c.Data[:i]), c.Data[i+1:]
+	compressed := false
+	switch c.Type {
+	case "zTXt":
+		if len(rest) < 1 {
+			return keyword, "", fmt.Errorf("pngchunk: zTXt %s: truncated", keyword)
+		}
+		compressed, rest = true, rest[1:]
+	case "iTXt":
+		if len(rest) < 2 {
+			return keyword, "", fmt.Errorf("pngchunk: iTXt %s: truncated", keyword)
+		}
+		compressed, rest = rest[0] == 1, rest[2:]
+		// Skip the language tag and the translated keyword.
+		for n := 0; n < 2; n++ {
+			j := bytes.IndexByte(rest, 0)
+			if j < 0 {
+				return keyword, "", fmt.Errorf("pngchunk: iTXt %s: truncated", keyword)
+			}
+			rest = rest[j+1:]
+		}
+	}
+	if compressed {
+		zr, err := zlib.NewReader(bytes.NewReader(rest))
+		if err != nil {
+			return keyword, "", fmt.Errorf("pngchunk: %s %s: %v", c.Type, keyword, err)
+		}
+		defer zr.Close()
+		if rest, err = ioutil.ReadAll(zr); err != nil {
+			return keyword, "", fmt.Errorf("pngchunk: %s %s: %v", c.Type, keyword, err)
+		}
+	}
+	return keyword, string(rest), nil
+}
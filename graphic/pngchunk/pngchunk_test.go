@@ -0,0 +1,149 @@
+// Daniel Bergström
+// dabergst@kth.se
+
+package pngchunk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/png"
+	"reflect"
+	"testing"
+)
+
+// encode returns a small PNG image.
+func encode(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func types(chunks []Chunk) []string {
+	var t []string
+	for _, c := range chunks {
+		t = append(t, c.Type)
+	}
+	return t
+}
+
+func TestReadWrite(t *testing.T) {
+	data := encode(t)
+	chunks, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := types(chunks); got[0] != "IHDR" || got[len(got)-1] != "IEND" {
+		t.Errorf("chunk types %v, want IHDR first and IEND last", got)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, chunks); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Error("writing the chunks read does not give the same file")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	data := encode(t)
+	corrupt := append([]byte(nil), data...)
+	// The last byte of the IHDR data.
+	corrupt[len(Signature)+8+12]++
+	for _, c := range []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a PNG", []byte("GIF89a and then some more bytes")},
+		{"truncated", data[:len(data)-6]},
+		{"no IEND", data[:len(data)-12]},
+		{"checksum", corrupt},
+	} {
+		if _, err := Read(bytes.NewReader(c.data)); err == nil {
+			t.Errorf("%s: Read succeeded", c.name)
+		}
+	}
+}
+
+func TestInsert(t *testing.T) {
+	data := encode(t)
+	chunks, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra := []Chunk{Text("Title", "Mandelbrot"), Text("Author", "me")}
+	want := InsertAfterHeader(chunks, extra...)
+	if got := types(want)[:3]; !reflect.DeepEqual(got, []string{"IHDR", "tEXt", "tEXt"}) {
+		t.Errorf("InsertAfterHeader: chunk types start with %v", got)
+	}
+
+	// The inserter gives the same stream however the writes are split.
+	for _, size := range []int{1, 7, len(data)} {
+		var buf bytes.Buffer
+		w := NewInserter(&buf, extra...)
+		for p := data; len(p) > 0; {
+			n := size
+			if n > len(p) {
+				n = len(p)
+			}
+			if k, err := w.Write(p[:n]); err != nil || k != n {
+				t.Fatalf("writes of %d: Write = %d, %v", size, k, err)
+			}
+			p = p[n:]
+		}
+		got, err := Read(&buf)
+		if err != nil {
+			t.Fatalf("writes of %d: %v", size, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("writes of %d: chunk types %v, want %v", size, types(got), types(want))
+		}
+	}
+
+	w := NewInserter(new(bytes.Buffer))
+	if _, err := w.Write(bytes.Repeat([]byte{'x'}, 64)); err == nil {
+		t.Error("inserting into a stream that is not a PNG succeeded")
+	}
+}
+
+func TestText(t *testing.T) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte("compressed"))
+	zw.Close()
+	for _, c := range []struct {
+		chunk         Chunk
+		keyword, text string
+	}{
+		{Text("Comment", "caf\xe9"), "Comment", "caf\xe9"},
+		{Text("Empty", ""), "Empty", ""},
+		{InternationalText("Layers", "[{\"Kind\": \"Palette\"}] ünïcode"), "Layers", "[{\"Kind\": \"Palette\"}] ünïcode"},
+		{Chunk{"zTXt", append([]byte("Z\x00\x00"), z.Bytes()...)}, "Z", "compressed"},
+		// Uncompressed iTXt with a language tag and translated keyword.
+		{Chunk{"iTXt", []byte("I\x00\x00\x00sv\x00Nyckel\x00text")}, "I", "text"},
+	} {
+		if !c.chunk.IsText() {
+			t.Errorf("%s chunk is not text", c.chunk.Type)
+		}
+		keyword, text, err := ParseText(c.chunk)
+		if err != nil || keyword != c.keyword || text != c.text {
+			t.Errorf("ParseText(%s) = %q, %q, %v, want %q, %q", c.chunk.Type, keyword, text, err, c.keyword, c.text)
+		}
+	}
+
+	for _, c := range []Chunk{
+		{"IDAT", []byte("a\x00b")},
+		{"tEXt", []byte("no separator")},
+		{"zTXt", []byte("Z\x00")},
+		{"zTXt", []byte("Z\x00\x00not zlib")},
+		{"iTXt", []byte("I\x00\x01")},
+		{"iTXt", []byte("I\x00\x00\x00sv")},
+	} {
+		if _, _, err := ParseText(c); err == nil {
+			t.Errorf("ParseText(%s %q) succeeded", c.Type, c.Data)
+		}
+	}
+}